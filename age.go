@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"find-large-dirs/scanner"
+)
+
+// parseAge parses durations like "90d", "2w" or "1y" on top of everything
+// time.ParseDuration accepts. A day is 24h, a week 7 days and a year 365.
+func parseAge(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	units := map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour, "y": 365 * 24 * time.Hour}
+	for suf, u := range units {
+		if n, ok := strings.CutSuffix(s, suf); ok {
+			v, err := strconv.ParseFloat(n, 64)
+			if err != nil || v < 0 {
+				return 0, fmt.Errorf("bad duration %q", s)
+			}
+			return time.Duration(v * float64(u)), nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("bad duration %q", s)
+	}
+	return d, nil
+}
+
+// parseTime parses an RFC 3339 timestamp, a local date and optional time
+// like "2024-05-01" or "2024-05-01 14:30", or a duration for parseAge
+// counted back from now.
+func parseTime(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02", "2006-01-02 15:04", "2006-01-02T15:04", "2006-01-02 15:04:05", "2006-01-02T15:04:05"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	d, err := parseAge(s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("bad time %q (want RFC 3339, YYYY-MM-DD or a duration like 24h)", s)
+	}
+	return now.Add(-d), nil
+}
+
+// ageLabels names the scanner.AgeBuckets for the histogram.
+var ageLabels = [len(scanner.AgeBuckets) + 1]string{"< 1 week", "< 1 month", "< 6 months", "< 1 year", "older"}
+
+// printAgeHistogram prints how the scanned bytes split by last
+// modification time.
+func printAgeHistogram(ages [len(scanner.AgeBuckets) + 1]int64) {
+	var total int64
+	for _, n := range ages {
+		total += n
+	}
+	if total == 0 {
+		return
+	}
+	fmt.Fprintln(stdout, "\nAge of data (by last modification):")
+	for i, n := range ages {
+		frac := float64(n) / float64(total)
+		fmt.Fprintf(stdout, "   %-12s %10s  %s%s%5.1f%%%s\n", ageLabels[i], formatSize(n), bar(frac), color(ColorGreen), frac*100, color(ColorReset))
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+
+	"find-large-dirs/scanner"
+)
+
+// printArchives prints the archives looked into with --peek-archives as
+// virtual directories, at most top of them.
+func printArchives(archives []scanner.ArchiveEntry, top int) {
+	if len(archives) == 0 {
+		return
+	}
+	fmt.Fprintf(stdout, "\n%sInside archives:%s\n", color(Bold), color(ColorReset))
+	for i, a := range archives {
+		if i >= top {
+			fmt.Fprintf(stdout, "   … and %s more\n", formatCount(int64(len(archives)-top)))
+			break
+		}
+		note := ""
+		if a.Partial {
+			note = fmt.Sprintf("  %s⚠ listed only partially%s", color(ColorYellow), color(ColorReset))
+		}
+		fmt.Fprintf(stdout, "   %s/  %s uncompressed, %s on disk  (%s files)%s\n", a.Path, formatSize(a.Uncompressed), formatSize(a.Size),
+			formatCount(a.FileCount), note)
+		fmt.Fprintf(stdout, "      mix: %s\n", formatFileTypeRatios(a.FileTypes, a.Uncompressed))
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"find-large-dirs/scanner"
+)
+
+// fetchBaseline downloads a history file from url to compare the scan
+// with instead of the local one. token, when set, is sent as a bearer
+// token. The file may be gzipped, as with a .gz db. It returns the
+// directories and the header of the file, as decodeDB does.
+func fetchBaseline(url, token string, timeout time.Duration) (map[string]*scanner.FolderSize, dbData, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, dbData{}, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	req.Header.Set("User-Agent", "find-large-dirs/"+version)
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, dbData{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, dbData{}, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	// Recognise a gzipped file by its magic number rather than by the
+	// name or headers, which servers set in all sorts of ways.
+	br := bufio.NewReader(resp.Body)
+	var r io.Reader = br
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, dbData{}, err
+		}
+		defer zr.Close()
+		r = zr
+	}
+	m, hdr, err := decodeDB(r)
+	if err != nil {
+		return nil, dbData{}, fmt.Errorf("%s: not a find-large-dirs db: %v", url, err)
+	}
+	return m, hdr, nil
+}
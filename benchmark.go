@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sort"
+	"time"
+
+	"find-large-dirs/scanner"
+)
+
+// benchRun is one timed scan of --benchmark.
+type benchRun struct {
+	workers int
+	took    time.Duration
+	dirs    int
+	bytes   int64
+}
+
+func (r benchRun) dirsPerSec() float64 { return float64(r.dirs) / r.took.Seconds() }
+
+// benchWorkers returns the worker counts to try: powers of two up to four
+// per CPU, plus the CPU count itself, which is the default.
+func benchWorkers() []int {
+	cpus := runtime.NumCPU()
+	counts := []int{cpus}
+	for n := 1; n <= 4*cpus; n *= 2 {
+		if n != cpus {
+			counts = append(counts, n)
+		}
+	}
+	sort.Ints(counts)
+	return counts
+}
+
+// runBenchmark backs --benchmark: it scans root once to warm the caches,
+// then once per worker count, and prints the throughput of each run with
+// the --workers and --slow-threshold it would pick for this storage.
+func runBenchmark(ctx context.Context, root string, opts scanner.Options) error {
+	// Every run must read every directory in full for the numbers to
+	// compare.
+	opts.Previous, opts.Progress, opts.Emit = nil, nil, nil
+	opts.SlowThreshold, opts.SlowDirThreshold = 0, 0
+	opts.TimeDirs = true
+	fmt.Fprintf(stdout, "Benchmarking '%s'…\n", root)
+	if _, err := scanner.Scan(ctx, root, opts); err != nil {
+		return err
+	}
+	fmt.Fprintln(stdout, "The first pass only warmed the caches; a cold scan will be slower.")
+	fmt.Fprintf(stdout, "\n%s%7s  %9s  %10s  %9s%s\n", color(Bold), "Workers", "Time", "Dirs/s", "MB/s", color(ColorReset))
+	var runs []benchRun
+	var times [][]time.Duration
+	for _, n := range benchWorkers() {
+		opts.Workers = n
+		start := time.Now()
+		m, stats, err := scanner.ScanStats(ctx, root, opts)
+		if err != nil {
+			return err
+		}
+		r := benchRun{n, time.Since(start), len(m), stats.BytesScanned}
+		runs = append(runs, r)
+		times = append(times, stats.DirTimes)
+		fmt.Fprintf(stdout, "%7d  %9s  %10.0f  %9.1f\n", n, r.took.Round(time.Millisecond), r.dirsPerSec(),
+			float64(r.bytes)/1e6/r.took.Seconds())
+	}
+	// Beyond the point where more workers stop paying off they only add
+	// load, so pick the fewest that come within 5% of the best run.
+	best := 0.0
+	for _, r := range runs {
+		best = max(best, r.dirsPerSec())
+	}
+	pick := 0
+	for i, r := range runs {
+		if r.dirsPerSec() >= best*0.95 {
+			pick = i
+			break
+		}
+	}
+	// The slow threshold should leave the slowest directory seen here
+	// twice the time it took, so that only a stalled mount trips it.
+	dt := times[pick]
+	sort.Slice(dt, func(i, j int) bool { return dt[i] < dt[j] })
+	var p99, slowest time.Duration
+	if len(dt) > 0 {
+		p99, slowest = dt[len(dt)*99/100], dt[len(dt)-1]
+	}
+	threshold := max(time.Second, (2*slowest + 499*time.Millisecond).Truncate(500*time.Millisecond))
+	fmt.Fprintf(stdout, "\n99%% of directories took under %s to read, the slowest %s.\n",
+		p99.Round(time.Microsecond), slowest.Round(time.Microsecond))
+	fmt.Fprintf(stdout, "Recommended: --workers %d --slow-threshold %s\n", runs[pick].workers, threshold)
+	return nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"find-large-dirs/scanner"
+)
+
+// categoryLimit is one --alert-category NAME=SIZE value.
+type categoryLimit struct {
+	Category string
+	Limit    int64
+}
+
+// categoryHit is a directory holding at least the limit of a category.
+type categoryHit struct {
+	categoryLimit
+	Dir  *scanner.FolderSize
+	Size int64
+}
+
+// parseCategoryLimit handles one --alert-category value. The name is
+// matched case-insensitively against the known categories.
+func parseCategoryLimit(v string, known []string) (categoryLimit, error) {
+	name, sz, ok := strings.Cut(v, "=")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" {
+		return categoryLimit{}, fmt.Errorf("want NAME=SIZE, got %q", v)
+	}
+	limit, err := parseSize(strings.TrimSpace(sz))
+	if err != nil {
+		return categoryLimit{}, err
+	}
+	if limit <= 0 {
+		return categoryLimit{}, fmt.Errorf("size for %s must be positive", name)
+	}
+	for _, k := range known {
+		if strings.EqualFold(name, k) {
+			return categoryLimit{Category: k, Limit: limit}, nil
+		}
+	}
+	return categoryLimit{}, fmt.Errorf("unknown category %q (known: %s)", name, strings.Join(known, ", "))
+}
+
+// categoryOverruns returns, for every limit, the innermost directories of
+// the aggregated map m whose subtree holds at least that much of the
+// category; their ancestors are over the limit only because of them.
+// The result is ordered by category as given, then largest first.
+func categoryOverruns(m map[string]*scanner.FolderSize, limits []categoryLimit) []categoryHit {
+	var out []categoryHit
+	for _, l := range limits {
+		over := map[string]bool{}
+		for p, fs := range m {
+			if fs.FileTypes[l.Category] >= l.Limit {
+				over[p] = true
+			}
+		}
+		// Every ancestor of a directory over the limit is over it too;
+		// only the ones with no such descendant are reported.
+		outer := map[string]bool{}
+		for p := range over {
+			for par := filepath.Dir(p); par != p && !outer[par]; p, par = par, filepath.Dir(par) {
+				outer[par] = true
+			}
+		}
+		var hits []categoryHit
+		for p := range over {
+			if !outer[p] {
+				hits = append(hits, categoryHit{l, m[p], m[p].FileTypes[l.Category]})
+			}
+		}
+		sort.Slice(hits, func(i, j int) bool {
+			if hits[i].Size != hits[j].Size {
+				return hits[i].Size > hits[j].Size
+			}
+			return hits[i].Dir.Path < hits[j].Dir.Path
+		})
+		out = append(out, hits...)
+	}
+	return out
+}
+
+// reportCategoryOverruns prints a one-line alert per category to stderr,
+// the same way --alert-size does.
+func reportCategoryOverruns(hits []categoryHit) {
+	for i, h := range hits {
+		if i > 0 && hits[i-1].Category == h.Category {
+			continue
+		}
+		n := 0
+		for _, o := range hits[i:] {
+			if o.Category == h.Category {
+				n++
+			}
+		}
+		fmt.Fprintf(os.Stderr, "alert: %d directories reached %s of %s, largest %s (%s)\n",
+			n, formatSize(h.Limit), h.Category, h.Dir.Path, formatSize(h.Size))
+	}
+}
+
+// printCategoryAlerts lists the directories over a --alert-category limit.
+func printCategoryAlerts(hits []categoryHit, top int) {
+	if len(hits) == 0 {
+		return
+	}
+	fmt.Fprintf(stdout, "\n%sCategory alerts:%s\n", color(Bold), color(ColorReset))
+	shown := map[string]int{}
+	for _, h := range hits {
+		shown[h.Category]++
+		if shown[h.Category] > top {
+			continue
+		}
+		fmt.Fprintf(stdout, "   %s%12s%s  %s  reached %s  %s\n", color(ColorRed), formatSize(h.Size), color(ColorReset),
+			padRight(h.Category, 10), formatSize(h.Limit), h.Dir.Path)
+	}
+}
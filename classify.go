@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"find-large-dirs/scanner"
+)
+
+// customColors holds category colors added with --add-category. It is
+// filled before the report is printed and only read afterwards.
+var customColors = map[string]string{}
+
+var colorNames = map[string]string{
+	"red":     ColorRed,
+	"green":   ColorGreen,
+	"yellow":  ColorYellow,
+	"blue":    ColorBlue,
+	"magenta": ColorMagenta,
+	"cyan":    ColorCyan,
+	"none":    ColorReset,
+}
+
+// parseCategoryColor handles one --add-category NAME=COLOR value.
+func parseCategoryColor(v string) error {
+	name, col, ok := strings.Cut(v, "=")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" {
+		return fmt.Errorf("want NAME=COLOR, got %q", v)
+	}
+	col = strings.ToLower(strings.TrimSpace(col))
+	code, ok := colorNames[col]
+	if n, err := strconv.Atoi(col); err == nil && n >= 0 && n <= 255 {
+		code, ok = fmt.Sprintf("\033[38;5;%dm", n), true
+	}
+	if !ok {
+		return fmt.Errorf("unknown color %q (want red, green, yellow, blue, magenta, cyan, none or a 256-color number)", col)
+	}
+	customColors[name] = code
+	scanner.AddCategory(name)
+	return nil
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"find-large-dirs/scanner"
+)
+
+// cachePatterns recognise directories whose contents a program rebuilds
+// on its own. A pattern is a path.Match glob matched against as many
+// trailing path elements as it has; --cache-pattern appends to the list.
+var cachePatterns = []string{
+	"node_modules",
+	".cache",
+	"__pycache__",
+	".pytest_cache",
+	".mypy_cache",
+	".ruff_cache",
+	".tox",
+	".gradle/caches",
+	".m2/repository",
+	".npm/_cacache",
+	".yarn/cache",
+	".cargo/registry/cache",
+	"go/pkg/mod/cache",
+	"go-build",
+	"pip/http*",
+	"Library/Caches",
+	"Cache",
+	"Code Cache",
+	"GPUCache",
+	"cache2",
+	"var/cache/apt/archives",
+}
+
+// suggestCleanup turns on the cache hints in the report and the summary
+// of reclaimable caches at the end.
+var suggestCleanup bool
+
+// cacheMatch returns the pattern p matches, or "" when p does not look
+// like a cache.
+func cacheMatch(p string) string {
+	parts := strings.Split(filepath.ToSlash(p), "/")
+	for _, pat := range cachePatterns {
+		n := strings.Count(pat, "/") + 1
+		if n > len(parts) {
+			continue
+		}
+		if ok, _ := path.Match(pat, strings.Join(parts[len(parts)-n:], "/")); ok {
+			return pat
+		}
+	}
+	return ""
+}
+
+// likelyCaches returns the outermost directories of m that look like
+// caches, largest first; a cache inside another one is already counted.
+func likelyCaches(m map[string]*scanner.FolderSize) []*scanner.FolderSize {
+	var out []*scanner.FolderSize
+	for p, fs := range m {
+		if fs.Total == 0 || cacheMatch(p) == "" {
+			continue
+		}
+		outer := false
+		for par := filepath.Dir(p); par != p; p, par = par, filepath.Dir(par) {
+			if m[par] != nil && cacheMatch(par) != "" {
+				outer = true
+				break
+			}
+		}
+		if !outer {
+			out = append(out, fs)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Total != out[j].Total {
+			return out[i].Total > out[j].Total
+		}
+		return out[i].Path < out[j].Path
+	})
+	return out
+}
+
+// printCleanup prints the total size of the likely caches and the top of
+// them.
+func printCleanup(m map[string]*scanner.FolderSize, top int) {
+	caches := likelyCaches(m)
+	if len(caches) == 0 {
+		return
+	}
+	var total int64
+	for _, fs := range caches {
+		total += fs.Total
+	}
+	fmt.Fprintf(stdout, "\n%sLikely caches: %s reclaimable in %s directories%s\n", color(Bold), formatSize(total), formatCount(int64(len(caches))), color(ColorReset))
+	for i, fs := range caches {
+		if i >= top {
+			fmt.Fprintf(stdout, "   … and %s more\n", formatCount(int64(len(caches)-top)))
+			break
+		}
+		fmt.Fprintf(stdout, "   %s%12s%s  %s  (%s)\n", color(ColorYellow), formatSize(fs.Total), color(ColorReset), fs.Path, cacheMatch(fs.Path))
+	}
+}
+
+// shellQuote quotes s for a POSIX shell: inside single quotes everything
+// is literal except the quote itself, which is closed, escaped and
+// reopened.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// writeRmScript writes a commented-out rm -rf line for every likely cache
+// of m, each under a comment with its size. As written the script does
+// nothing; the lines to run have to be uncommented by hand. Paths with a
+// line break cannot sit on one commented line and are only named, quoted
+// Go-style, as is the root in the header.
+func writeRmScript(w io.Writer, m map[string]*scanner.FolderSize, root string) error {
+	caches := likelyCaches(m)
+	var total int64
+	for _, fs := range caches {
+		total += fs.Total
+	}
+	fmt.Fprintf(w, "#!/bin/sh\n# Likely caches below %q, found by find-large-dirs on %s.\n", root, time.Now().Format("2006-01-02 15:04"))
+	fmt.Fprintf(w, "# %s in %s directories.\n#\n", formatSize(total), formatCount(int64(len(caches))))
+	fmt.Fprintln(w, "# REVIEW BEFORE RUNNING: every command below deletes a directory for good.")
+	fmt.Fprintln(w, "# They are commented out; uncomment only those you are sure of.")
+	fmt.Fprintln(w, "set -eu")
+	for _, fs := range caches {
+		fmt.Fprintf(w, "\n# %s  (%s)\n", formatSize(fs.Total), cacheMatch(fs.Path))
+		line := "# rm -rf -- " + shellQuote(fs.Path)
+		if strings.ContainsAny(fs.Path, "\n\r") {
+			line = fmt.Sprintf("# left out, the path has a line break: %q", fs.Path)
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportRmScript writes the --emit-rm script to path, or to stdout for
+// "-". The file is never made executable.
+func exportRmScript(path string, m map[string]*scanner.FolderSize, root string) error {
+	if path == "-" {
+		return writeRmScript(stdout, m, root)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if err := f.Chmod(0o644); err != nil {
+		f.Close()
+		return err
+	}
+	if err := writeRmScript(f, m, root); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// defaultConfigPath returns $XDG_CONFIG_HOME/find-large-dirs/config.json,
+// falling back to ~/.config when XDG_CONFIG_HOME is unset.
+func defaultConfigPath() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "find-large-dirs", "config.json")
+}
+
+// configFromArgs looks through args for --config and --no-config ahead of
+// flag.Parse, since the file has to be applied before the command line.
+func configFromArgs(args []string) (path string, explicit, disabled bool) {
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		if a == "--" || !strings.HasPrefix(a, "-") {
+			break
+		}
+		name, val, hasVal := strings.Cut(strings.TrimLeft(a, "-"), "=")
+		switch name {
+		case "no-config":
+			disabled = !hasVal || val == "true"
+		case "config":
+			if !hasVal && i+1 < len(args) {
+				i++
+				val = args[i]
+			}
+			path, explicit = val, true
+		}
+	}
+	if !explicit {
+		path = defaultConfigPath()
+	}
+	return path, explicit, disabled
+}
+
+// loadConfig sets flags from the JSON object in the file at path. Keys are
+// flag names; values are strings, numbers or booleans, or arrays of them
+// for repeatable flags such as "exclude". A missing file is only an error
+// when it was named explicitly.
+func loadConfig(path string, explicit bool) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && !explicit {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var cfg map[string]interface{}
+	if err := dec.Decode(&cfg); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	for name, v := range cfg {
+		if name == "config" || name == "no-config" || flag.Lookup(name) == nil {
+			return fmt.Errorf("%s: unknown option %q", path, name)
+		}
+		vals, ok := v.([]interface{})
+		if !ok {
+			vals = []interface{}{v}
+		}
+		for _, v := range vals {
+			if err := flag.Set(name, fmt.Sprint(v)); err != nil {
+				return fmt.Errorf("%s: %s: %v", path, name, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+
+	"find-large-dirs/scanner"
+)
+
+// printDupes prints the total space held by duplicate copies followed by
+// the top sets of identical files.
+func printDupes(sets []scanner.DupeSet, top int) {
+	var reclaim int64
+	for _, d := range sets {
+		reclaim += d.Reclaimable()
+	}
+	fmt.Fprintf(stdout, "\n%sDuplicates: %s reclaimable in %s sets%s\n", color(Bold), formatSize(reclaim), formatCount(int64(len(sets))), color(ColorReset))
+	for i, d := range sets {
+		if i >= top {
+			fmt.Fprintf(stdout, "   … and %s more sets\n", formatCount(int64(len(sets)-top)))
+			break
+		}
+		fmt.Fprintf(stdout, "   %d × %s  (%s%s%s reclaimable)\n", len(d.Paths), formatSize(d.Size), color(ColorYellow), formatSize(d.Reclaimable()), color(ColorReset))
+		for _, p := range d.Paths {
+			fmt.Fprintf(stdout, "      %s\n", p)
+		}
+	}
+}
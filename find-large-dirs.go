@@ -3,43 +3,31 @@
 package main
 
 import (
-	"container/list"
+	"compress/gzip"
 	"context"
+	"encoding/csv"
 	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
-	"io/ioutil"
+	"io"
+	"math"
 	"os"
 	"os/signal"
+	"path"
 	"path/filepath"
 	"regexp"
+	"runtime"
 	"sort"
 	"strconv"
 	"strings"
-	"sync/atomic"
 	"time"
+
+	"find-large-dirs/scanner"
 )
 
 var version = "v2.1"
 
-type FolderSize struct {
-	Path      string           `json:"path"`
-	Size      int64            `json:"size_bytes"`
-	Total     int64            `json:"total_bytes"`
-	FileCount int64            `json:"file_count"`
-	Oldest    time.Time        `json:"oldest_mtime"`
-	Newest    time.Time        `json:"newest_mtime"`
-	Skipped   bool             `json:"skipped"`
-	FileTypes map[string]int64 `json:"types_bytes"`
-}
-
-type progressUpdate struct {
-	CurrentDir string
-	NumDirs    int64
-	BytesTotal int64
-}
-
 type multiFlag []string
 
 func (m *multiFlag) String() string { return strings.Join(*m, ",") }
@@ -56,7 +44,91 @@ const (
 	Bold         = "\033[1m"
 )
 
+// useColor is decided once in main from --color, --no-color and whether
+// stdout is a terminal.
+var useColor = true
+
+// barWidth is the width in cells of the bars drawn next to percentages;
+// 0 turns them off. Bars are only drawn when colors are on.
+var barWidth = 10
+
+// bar renders frac (0..1) as a fixed-width bar followed by a space, or ""
+// when bars are off.
+func bar(frac float64) string {
+	if barWidth <= 0 || !useColor {
+		return ""
+	}
+	n := int(math.Round(math.Max(0, math.Min(1, frac)) * float64(barWidth)))
+	return color(ColorCyan) + strings.Repeat("█", n) + color(ColorReset) + strings.Repeat("░", barWidth-n) + " "
+}
+
+// stdout receives the report, os.Stdout unless --output names a file.
+var stdout io.Writer = os.Stdout
+
+// errWriter passes writes through to w and keeps the first error, so a
+// report can be written without checking every print.
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (e *errWriter) Write(p []byte) (int, error) {
+	if e.err != nil {
+		return 0, e.err
+	}
+	n, err := e.w.Write(p)
+	e.err = err
+	return n, err
+}
+
+// sizeUnits selects how formatSize scales and labels sizes: "iec" for
+// 1024-based KiB/MiB/GiB, "si" for 1000-based kB/MB/GB, and "legacy" for
+// 1024-based values labelled KB/MB/GB as older versions printed them.
+var sizeUnits = "iec"
+
+// parseSize reads a size given on the command line. With --si the "kB",
+// "MB", "GB"… suffixes are 1000-based, matching the output.
+func parseSize(s string) (int64, error) {
+	return scanner.ParseSizeUnits(s, sizeUnits == "si")
+}
+
+// disk is the capacity of the filesystem holding the scan root. A zero
+// Total means it could not be determined and disk shares are not shown.
+var disk scanner.Disk
+
+// selfOnly ranks and filters directories by the files directly inside
+// them rather than by their whole subtree, set by --no-aggregate.
+var selfOnly bool
+
+// shownSize is the size a directory is ranked and filtered by.
+func shownSize(fs *scanner.FolderSize) int64 {
+	if selfOnly {
+		return fs.Size
+	}
+	return fs.Total
+}
+
+// color returns c, or an empty string when color output is disabled.
+func color(c string) string {
+	if !useColor {
+		return ""
+	}
+	if p, ok := palette[c]; ok {
+		return p
+	}
+	return c
+}
+
+// isTerminal reports whether f is attached to a character device.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
 func getColorForCategory(c string) string {
+	if col, ok := customColors[c]; ok {
+		return col
+	}
 	switch c {
 	case "Image":
 		return ColorYellow
@@ -92,144 +164,196 @@ func getColorForCategory(c string) string {
 		return ColorMagenta
 	case "Presentation":
 		return ColorBlue
+	case "Container":
+		return ColorCyan
 	default:
 		return ColorReset
 	}
 }
 
+// formatSize renders b scaled and labelled as selected by sizeUnits.
 func formatSize(b int64) string {
-	switch {
-	case b >= 1<<40:
-		return fmt.Sprintf("%.2f TB", float64(b)/(1<<40))
-	case b >= 1<<30:
-		return fmt.Sprintf("%.2f GB", float64(b)/(1<<30))
-	case b >= 1<<20:
-		return fmt.Sprintf("%.2f MB", float64(b)/(1<<20))
-	case b >= 1<<10:
-		return fmt.Sprintf("%.1f KB", float64(b)/(1<<10))
-	default:
+	base, labels := float64(1<<10), [...]string{"B", "KiB", "MiB", "GiB", "TiB"}
+	switch sizeUnits {
+	case "si":
+		base, labels = 1000, [...]string{"B", "kB", "MB", "GB", "TB"}
+	case "legacy":
+		labels = [...]string{"B", "KB", "MB", "GB", "TB"}
+	}
+	v, i := float64(b), 0
+	for i < len(labels)-1 && v >= base {
+		v /= base
+		i++
+	}
+	switch i {
+	case 0:
 		return fmt.Sprintf("%d B", b)
+	case 1:
+		return fmt.Sprintf("%.1f %s", v, labels[i])
+	default:
+		return fmt.Sprintf("%.2f %s", v, labels[i])
 	}
 }
 
-func shortenPath(p string, n int) string {
-	if len(p) <= n {
-		return p
+// warnBytes and critBytes are the sizes from which colorSize turns yellow
+// and red, set by --warn-size and --crit-size.
+var warnBytes, critBytes int64 = 10 << 30, 100 << 30
+
+// tinyAvg and tinyCount trigger the "many tiny files" hint: more than
+// tinyCount files averaging below tinyAvg. manySubdirs triggers the hint
+// about wide directories. advise false drops all of these hints.
+var (
+	tinyAvg     int64 = 64 << 10
+	tinyCount   int64 = 1000
+	manySubdirs       = 1000
+	advise            = true
+)
+
+// childLimit and childMinPct cut the sub-folder listing of the report
+// after that many entries (0 lists them all) or below that share of the
+// parent. A child holding more than dominantPct percent is shown alone.
+var (
+	childLimit          = 5
+	childMinPct float64 = 5
+	dominantPct float64 = 80
+)
+
+// colorSize is formatSize colored by magnitude: green below warnBytes,
+// yellow below critBytes and red from there on.
+func colorSize(b int64) string {
+	c := ColorGreen
+	switch {
+	case b >= critBytes:
+		c = ColorRed
+	case b >= warnBytes:
+		c = ColorYellow
 	}
-	return p[:n-3] + "..."
+	return color(c) + formatSize(b) + color(ColorReset) + sizeMarker(c)
 }
 
-func parseSize(s string) (int64, error) {
-	s = strings.TrimSpace(strings.ToUpper(s))
-	re := regexp.MustCompile(`^([0-9]*\.?[0-9]+)\s*([KMGTP]?)B?$`)
-	m := re.FindStringSubmatch(s)
-	if m == nil {
-		return 0, errors.New("bad size")
-	}
-	v, _ := strconv.ParseFloat(m[1], 64)
-	mult := int64(1)
-	switch m[2] {
-	case "K":
-		mult = 1 << 10
-	case "M":
-		mult = 1 << 20
-	case "G":
-		mult = 1 << 30
-	case "T":
-		mult = 1 << 40
-	case "P":
-		mult = 1 << 50
-	}
-	return int64(v * float64(mult)), nil
-}
-
-func isExcluded(p string, ex []string) bool {
-	for _, e := range ex {
-		if strings.HasPrefix(p, e) {
-			return true
-		}
-	}
-	switch strings.ToLower(filepath.Base(p)) {
-	case "proc", "sys", "dev", "run", "tmp", "var":
-		return true
-	default:
-		return false
-	}
-}
-
-func classifyExtension(n string) string {
-	switch strings.ToLower(filepath.Ext(n)) {
-	case ".jpg", ".jpeg", ".png", ".gif", ".bmp", ".tiff", ".raw", ".webp", ".heic", ".heif":
-		return "Image"
-	case ".mp4", ".mov", ".avi", ".mkv", ".flv", ".wmv", ".webm", ".m4v":
-		return "Video"
-	case ".mp3", ".wav", ".flac", ".aac", ".ogg", ".m4a", ".wma":
-		return "Audio"
-	case ".zip", ".rar", ".7z", ".tar", ".gz", ".bz2", ".xz":
-		return "Archive"
-	case ".pdf", ".doc", ".docx", ".txt", ".rtf":
-		return "Document"
-	case ".exe", ".dll", ".so", ".bin", ".dmg", ".pkg", ".apk":
-		return "Application"
-	case ".go", ".c", ".cpp", ".h", ".hpp", ".js", ".ts", ".py", ".java", ".sh", ".rb", ".php":
-		return "Code"
-	case ".log", ".trace":
-		return "Log"
-	case ".db", ".sqlite", ".sqlite3", ".rdb":
-		return "Database"
-	case ".bak", ".backup":
-		return "Backup"
-	case ".sql":
-		return "DB-Backup"
-	case ".iso", ".img", ".vhd", ".vhdx", ".vmdk":
-		return "Disk Image"
-	case ".conf", ".cfg", ".ini", ".yaml", ".yml", ".json", ".xml":
-		return "Configuration"
-	case ".ttf", ".otf", ".woff":
-		return "Font"
-	case ".html", ".htm", ".css":
-		return "Web"
-	case ".ods", ".xls", ".xlsx", ".csv":
-		return "Spreadsheet"
-	case ".odp", ".ppt", ".pptx":
-		return "Presentation"
-	default:
-		return "Other"
+// signedSize formats a size difference with an explicit sign.
+func signedSize(d int64) string {
+	if d < 0 {
+		return "-" + formatSize(-d)
 	}
+	return "+" + formatSize(d)
 }
 
-func formatFileTypeRatios(m map[string]int64, total int64) string {
-	if total == 0 {
-		return "empty"
+// formatCount renders n with thousands separators, e.g. 3,200.
+func formatCount(n int64) string {
+	s := strconv.FormatInt(n, 10)
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
 	}
-	type pair struct {
-		C string
-		S int64
+	if neg {
+		s = "-" + s
 	}
-	var ps []pair
+	return s
+}
+
+// signedCount formats a count difference with an explicit sign.
+func signedCount(d int64) string {
+	if d < 0 {
+		return formatCount(d)
+	}
+	return "+" + formatCount(d)
+}
+
+// typeShare is one category's byte count within a directory.
+type typeShare struct {
+	C string
+	S int64
+}
+
+// typeShares returns the non-empty categories of m, largest first.
+func typeShares(m map[string]int64) []typeShare {
+	var ps []typeShare
 	for c, s := range m {
 		if s > 0 {
-			ps = append(ps, pair{c, s})
+			ps = append(ps, typeShare{c, s})
+		}
+	}
+	sort.Slice(ps, func(i, j int) bool {
+		if ps[i].S != ps[j].S {
+			return ps[i].S > ps[j].S
 		}
+		return ps[i].C < ps[j].C
+	})
+	return ps
+}
+
+func formatFileTypeRatios(m map[string]int64, total int64) string {
+	if total == 0 {
+		return "empty"
 	}
-	sort.Slice(ps, func(i, j int) bool { return ps[i].S > ps[j].S })
+	ps := typeShares(m)
 	out := make([]string, 0, len(ps))
 	for _, p := range ps {
-		out = append(out, fmt.Sprintf("%s%.1f%%%s %s%s%s", ColorGreen, float64(p.S)*100/float64(total), ColorReset, getColorForCategory(p.C), p.C, ColorReset))
+		out = append(out, fmt.Sprintf("%s%.1f%%%s %s%s%s", color(ColorGreen), float64(p.S)*100/float64(total), color(ColorReset), color(getColorForCategory(p.C)), p.C, color(ColorReset)))
 	}
 	return strings.Join(out, ", ")
 }
 
+// dbVersion is the current history schema. Version 1 files only carried
+// dbEntry path/size pairs; version 2 stores whole scanner.FolderSize records.
+const dbVersion = 2
+
 type dbEntry struct {
 	Path string `json:"path"`
 	Sz   int64  `json:"size"`
 }
 type dbData struct {
-	Timestamp time.Time `json:"timestamp"`
-	Entries   []dbEntry `json:"entries"`
+	Version   int                   `json:"version,omitempty"`
+	Timestamp time.Time             `json:"timestamp"`
+	Entries   []dbEntry             `json:"entries,omitempty"`
+	Dirs      []*scanner.FolderSize `json:"dirs,omitempty"`
+	// ScanSeconds is how long the scan took, to spot a filesystem that
+	// gets slower over time.
+	ScanSeconds float64 `json:"scan_seconds,omitempty"`
+	// Partial marks a record saved from an interrupted or failed scan.
+	Partial bool `json:"partial,omitempty"`
+	// Settings are the options the scan counted with; nil in files
+	// from before they were saved.
+	Settings *scanSettings `json:"settings,omitempty"`
+}
+
+// scanSettings are the options that decide which files a directory's
+// record counts and how. --incremental only reuses records counted the
+// same way as the scan at hand.
+type scanSettings struct {
+	ApparentSize   bool `json:"apparent_size,omitempty"`
+	CountLinks     bool `json:"count_links,omitempty"`
+	NoHidden       bool `json:"no_hidden,omitempty"`
+	NoHiddenFiles  bool `json:"no_hidden_files,omitempty"`
+	UseGitignore   bool `json:"use_gitignore,omitempty"`
+	FollowSymlinks bool `json:"follow_symlinks,omitempty"`
+	PeekArchives   bool `json:"peek_archives,omitempty"`
+}
+
+// settingsOf picks the scanSettings out of opts.
+func settingsOf(opts scanner.Options) scanSettings {
+	return scanSettings{opts.ApparentSize, opts.CountLinks, opts.NoHidden, opts.NoHiddenFiles, opts.UseGitignore, opts.FollowSymlinks, opts.PeekArchives}
 }
 
-func dbPath() string {
+// savedSettings is what saveCurrent records as dbData.Settings.
+var savedSettings scanSettings
+
+// took returns how long the saved scan took.
+func (d dbData) took() time.Duration {
+	return time.Duration(d.ScanSeconds * float64(time.Second))
+}
+
+// dbPath picks the history file: the --db flag, then $FIND_LARGE_DIRS_DB,
+// then ~/.find-large-dirs/db.json.
+func dbPath(override string) string {
+	if override != "" {
+		return override
+	}
+	if env := os.Getenv("FIND_LARGE_DIRS_DB"); env != "" {
+		return env
+	}
 	home, err := os.UserHomeDir()
 	if err != nil {
 		return "./find-large-dirs-db.json"
@@ -237,136 +361,291 @@ func dbPath() string {
 	return filepath.Join(home, ".find-large-dirs", "db.json")
 }
 
-func loadPrev(p string) (map[string]int64, time.Time) {
-	m := map[string]int64{}
+// gzipped reports whether the history file at p is stored compressed.
+func gzipped(p string) bool {
+	return strings.HasSuffix(p, ".gz")
+}
+
+// partialPath is where saveHistory puts an interrupted or failed scan
+// instead of the history file p: next to it, keeping any .gz suffix.
+func partialPath(p string) string {
+	if gzipped(p) {
+		return strings.TrimSuffix(p, ".gz") + ".partial.gz"
+	}
+	return p + ".partial"
+}
+
+// saveHistory is saveCurrent for the history file. A partial scan goes
+// next to it, so that the last complete scan stays the baseline for
+// growth, churn and --incremental; a complete one replaces both.
+func saveHistory(p string, m map[string]*scanner.FolderSize, took time.Duration, partial bool) {
+	if p == "" {
+		return
+	}
+	if partial {
+		saveCurrent(partialPath(p), m, took, true)
+		return
+	}
+	saveCurrent(p, m, took, false)
+	os.Remove(partialPath(p))
+}
+
+// loadPrev reads the history file at p with its header, which has a zero
+// Timestamp when there is none. An empty p disables history. Records from
+// version 1 files only have Path and Total set, and a nil FileTypes map
+// marks them as such.
+func loadPrev(p string) (map[string]*scanner.FolderSize, dbData) {
+	m := map[string]*scanner.FolderSize{}
+	if p == "" {
+		return m, dbData{}
+	}
 	f, err := os.Open(p)
 	if err != nil {
-		return m, time.Time{}
+		return m, dbData{}
 	}
 	defer f.Close()
+	var r io.Reader = f
+	if gzipped(p) {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			return m, dbData{}
+		}
+		defer zr.Close()
+		r = zr
+	}
+	prev, hdr, err := decodeDB(r)
+	if err != nil {
+		return m, dbData{}
+	}
+	return prev, hdr
+}
+
+// decodeDB reads a history file as saveCurrent writes it, returning its
+// directories and its header, the dbData without them.
+func decodeDB(r io.Reader) (map[string]*scanner.FolderSize, dbData, error) {
 	var db dbData
-	if json.NewDecoder(f).Decode(&db) != nil {
-		return m, time.Time{}
+	if err := json.NewDecoder(r).Decode(&db); err != nil {
+		return nil, dbData{}, err
 	}
+	m := map[string]*scanner.FolderSize{}
 	for _, e := range db.Entries {
-		m[e.Path] = e.Sz
+		m[e.Path] = &scanner.FolderSize{Path: e.Path, Total: e.Sz}
 	}
-	return m, db.Timestamp
+	for _, fs := range db.Dirs {
+		if fs.FileTypes == nil {
+			fs.FileTypes = map[string]int64{}
+		}
+		m[fs.Path] = fs
+	}
+	db.Entries, db.Dirs = nil, nil
+	return m, db, nil
 }
 
-func saveCurrent(p string, m map[string]*FolderSize) {
+func saveCurrent(p string, m map[string]*scanner.FolderSize, took time.Duration, partial bool) {
+	if p == "" {
+		return
+	}
 	_ = os.MkdirAll(filepath.Dir(p), 0o750)
 	f, err := os.Create(p)
 	if err != nil {
 		return
 	}
 	defer f.Close()
-	db := dbData{Timestamp: time.Now()}
+	db := dbData{Version: dbVersion, Timestamp: time.Now(), ScanSeconds: took.Seconds(), Partial: partial, Settings: &savedSettings}
 	for _, fs := range m {
-		db.Entries = append(db.Entries, dbEntry{fs.Path, fs.Total})
+		db.Dirs = append(db.Dirs, fs)
+	}
+	sort.Slice(db.Dirs, func(i, j int) bool { return db.Dirs[i].Path < db.Dirs[j].Path })
+	if gzipped(p) {
+		zw := gzip.NewWriter(f)
+		defer zw.Close()
+		_ = json.NewEncoder(zw).Encode(db)
+		return
 	}
 	enc := json.NewEncoder(f)
 	enc.SetIndent("", "  ")
 	_ = enc.Encode(db)
 }
 
-func bfsScan(ctx context.Context, root string, excl []string, slow time.Duration, prog chan<- progressUpdate) map[string]*FolderSize {
-	res := map[string]*FolderSize{}
-	ensure := func(p string) *FolderSize {
-		if fs, ok := res[p]; ok {
-			return fs
-		}
-		fs := &FolderSize{Path: p, FileTypes: map[string]int64{}}
-		res[p] = fs
-		return fs
+// writeJSON encodes dirs as an indented JSON array. A nil slice is written
+// as [] so consumers always get an array.
+func writeJSON(w io.Writer, dirs []*scanner.FolderSize) error {
+	out := make([]*scanner.FolderSize, len(dirs))
+	for i, fs := range dirs {
+		out[i] = zoned(fs)
 	}
-	q := list.New()
-	q.PushBack(root)
-	var dirCnt, bytesTotal int64
-scan:
-	for q.Len() > 0 {
-		select {
-		case <-ctx.Done():
-			break scan
-		default:
-		}
-		e := q.Front()
-		q.Remove(e)
-		dir := e.Value.(string)
-		if isExcluded(dir, excl) {
-			ensure(dir).Skipped = true
-			continue
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+// writeCSV writes one row per directory with a byte column per category.
+func writeCSV(w io.Writer, dirs []*scanner.FolderSize) error {
+	cw := csv.NewWriter(w)
+	head := []string{"path", "total_bytes", "file_count", "subdir_count", "oldest_mtime", "newest_mtime"}
+	cats := scanner.KnownCategories()
+	if err := cw.Write(append(head, cats...)); err != nil {
+		return err
+	}
+	for _, fs := range dirs {
+		row := []string{
+			fs.Path,
+			strconv.FormatInt(fs.Total, 10),
+			strconv.FormatInt(fs.FileCount, 10),
+			strconv.FormatInt(fs.SubdirCount, 10),
+			formatTime(fs.Oldest),
+			formatTime(fs.Newest),
 		}
-		start := time.Now()
-		ents, err := ioutil.ReadDir(dir)
-		if err != nil {
-			ensure(dir).Skipped = true
-			continue
+		for _, c := range cats {
+			row = append(row, strconv.FormatInt(fs.FileTypes[c], 10))
 		}
-		fsDir := ensure(dir)
-		for _, fi := range ents {
-			if fi.IsDir() {
-				q.PushBack(filepath.Join(dir, fi.Name()))
-				continue
-			}
-			fsDir.Size += fi.Size()
-			fsDir.FileTypes[classifyExtension(fi.Name())] += fi.Size()
-			fsDir.FileCount++
-			mt := fi.ModTime()
-			if fsDir.Oldest.IsZero() || mt.Before(fsDir.Oldest) {
-				fsDir.Oldest = mt
-			}
-			if mt.After(fsDir.Newest) {
-				fsDir.Newest = mt
-			}
-			if time.Since(start) > slow {
-				fsDir.Skipped = true
-				break
-			}
+		if err := cw.Write(row); err != nil {
+			return err
 		}
-		fsDir.Total = fsDir.Size
-		atomic.AddInt64(&dirCnt, 1)
-		atomic.AddInt64(&bytesTotal, fsDir.Size)
-		prog <- progressUpdate{dir, atomic.LoadInt64(&dirCnt), atomic.LoadInt64(&bytesTotal)}
 	}
-	return res
+	cw.Flush()
+	return cw.Error()
 }
 
-func aggregateTotals(m map[string]*FolderSize) {
-	paths := make([]string, 0, len(m))
-	for p := range m {
-		paths = append(paths, p)
+// exportCSV writes dirs to path, or to stdout when path is "-".
+func exportCSV(path string, dirs []*scanner.FolderSize) error {
+	if path == "-" {
+		return writeCSV(stdout, dirs)
 	}
-	sort.Slice(paths, func(i, j int) bool {
-		return strings.Count(paths[i], string(os.PathSeparator)) > strings.Count(paths[j], string(os.PathSeparator))
-	})
-	for _, p := range paths {
-		fs := m[p]
-		par := filepath.Dir(p)
-		if par == p {
-			continue
-		}
-		ps := m[par]
-		if ps == nil {
-			ps = &FolderSize{Path: par, FileTypes: map[string]int64{}}
-			m[par] = ps
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := writeCSV(f, dirs); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// dateLayout is how the report shows dates and timeLayout how CSV
+// writes them; --date-format sets both. inUTC, set by --utc, shows every
+// time in UTC instead of local time, JSON included.
+var (
+	dateLayout = "2006-01-02"
+	timeLayout = time.RFC3339
+	inUTC      bool
+)
+
+// zone returns t in the time zone the output uses. An unset time stays
+// the zero time.
+func zone(t time.Time) time.Time {
+	if t.IsZero() {
+		return t
+	}
+	if inUTC {
+		return t.UTC()
+	}
+	return t.Local()
+}
+
+// formatDate renders t for the human-readable report.
+func formatDate(t time.Time) string {
+	return zone(t).Format(dateLayout)
+}
+
+// formatTime renders t for CSV, leaving unset times empty.
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return zone(t).Format(timeLayout)
+}
+
+// zoned returns fs with its times moved to the output's time zone. fs
+// itself is returned when nothing changes, and a copy otherwise.
+func zoned(fs *scanner.FolderSize) *scanner.FolderSize {
+	if !inUTC {
+		return fs
+	}
+	c := *fs
+	c.Oldest, c.Newest, c.DirMtime = zone(c.Oldest), zone(c.Newest), zone(c.DirMtime)
+	return &c
+}
+
+// folderLess returns the ordering selected by --sort: size and count put the
+// largest first, age the oldest data first and name sorts by path.
+func folderLess(key string, reverse bool) (func(a, b *scanner.FolderSize) bool, error) {
+	var less func(a, b *scanner.FolderSize) bool
+	switch key {
+	case "size":
+		less = func(a, b *scanner.FolderSize) bool { return shownSize(a) > shownSize(b) }
+	case "count":
+		less = func(a, b *scanner.FolderSize) bool { return a.FileCount > b.FileCount }
+	case "age":
+		less = func(a, b *scanner.FolderSize) bool {
+			if a.Oldest.IsZero() || b.Oldest.IsZero() {
+				return !a.Oldest.IsZero()
+			}
+			return a.Oldest.Before(b.Oldest)
 		}
-		ps.Total += fs.Total
-		ps.FileCount += fs.FileCount
-		if ps.Oldest.IsZero() || (!fs.Oldest.IsZero() && fs.Oldest.Before(ps.Oldest)) {
-			ps.Oldest = fs.Oldest
+	case "name":
+		less = func(a, b *scanner.FolderSize) bool { return a.Path < b.Path }
+	default:
+		return nil, fmt.Errorf("unknown sort key %q (want size, count, age or name)", key)
+	}
+	// Ties fall back to the path, ascending either way, so that equal
+	// directories keep the same order from run to run.
+	return func(a, b *scanner.FolderSize) bool {
+		switch {
+		case less(a, b):
+			return !reverse
+		case less(b, a):
+			return reverse
 		}
-		if fs.Newest.After(ps.Newest) {
-			ps.Newest = fs.Newest
+		return a.Path < b.Path
+	}, nil
+}
+
+// expandPath turns p into an absolute, clean path with symlinks resolved,
+// expanding a leading "~" to the home directory, so that it compares
+// equal to the paths a scan produces. Parts that cannot be resolved, such
+// as a path that does not exist, are left as they are.
+func expandPath(p string) string {
+	if p == "~" || strings.HasPrefix(p, "~/") || strings.HasPrefix(p, "~"+string(filepath.Separator)) {
+		if home, err := os.UserHomeDir(); err == nil {
+			p = filepath.Join(home, p[1:])
 		}
-		for c, s := range fs.FileTypes {
-			ps.FileTypes[c] += s
+	}
+	if abs, err := filepath.Abs(p); err == nil {
+		p = abs
+	}
+	if real, err := filepath.EvalSymlinks(p); err == nil {
+		p = real
+	}
+	return p
+}
+
+// relDepth returns how many levels p lies below root, or -1 when it is
+// not inside root.
+func relDepth(root, p string) int {
+	rel, err := filepath.Rel(root, p)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return -1
+	}
+	if rel == "." {
+		return 0
+	}
+	return strings.Count(rel, string(filepath.Separator)) + 1
+}
+
+// dropOutside removes the records that are not inside root, such as the
+// parent of the root that AggregateTotals creates.
+func dropOutside(m map[string]*scanner.FolderSize, root string) {
+	for p := range m {
+		if relDepth(root, p) < 0 {
+			delete(m, p)
 		}
 	}
 }
 
-func directChildren(m map[string]*FolderSize, par string) []*FolderSize {
-	var out []*FolderSize
+func directChildren(m map[string]*scanner.FolderSize, par string) []*scanner.FolderSize {
+	var out []*scanner.FolderSize
 	for p, fs := range m {
 		if filepath.Dir(p) == par && p != par {
 			out = append(out, fs)
@@ -375,146 +654,1551 @@ func directChildren(m map[string]*FolderSize, par string) []*FolderSize {
 	return out
 }
 
-func progressReporter(ctx context.Context, prog <-chan progressUpdate, done chan<- struct{}) {
+// progressRate is the progress line's view of the scan: the latest update,
+// the rates over the last few seconds and, when the size to expect is
+// known, how far along the scan is.
+type progressRate struct {
+	scanner.Progress
+	DirsPerSec  float64 `json:"dirs_per_sec"`
+	BytesPerSec float64 `json:"bytes_per_sec"`
+	Percent     float64 `json:"percent,omitempty"`
+	ETASeconds  float64 `json:"eta_seconds,omitempty"`
+}
+
+// rateWindow is how far back progressReporter looks to compute rates.
+const rateWindow = 5 * time.Second
+
+// estimateBudget is how long --estimate samples the tree before the scan.
+const estimateBudget = 2 * time.Second
+
+// progressReporter shows the latest update from prog every tick, either as
+// a status line on stderr or, with asJSON, as a JSON line on stderr.
+// expect, when positive, is the number of bytes the scan should end up
+// with, which turns on the percentage and the ETA.
+func progressReporter(ctx context.Context, prog <-chan scanner.Progress, done chan<- struct{}, asJSON bool, expect int64) {
 	tick := time.NewTicker(300 * time.Millisecond)
 	defer tick.Stop()
-	var last progressUpdate
+	var last scanner.Progress
+	type sample struct {
+		at          time.Time
+		dirs, bytes int64
+	}
+	window := []sample{{at: time.Now()}}
+	// rate updates the window with the latest update and derives the
+	// rates from its oldest sample.
+	rate := func() progressRate {
+		now := time.Now()
+		window = append(window, sample{now, last.NumDirs, last.BytesTotal})
+		for len(window) > 2 && now.Sub(window[1].at) >= rateWindow {
+			window = window[1:]
+		}
+		r := progressRate{Progress: last}
+		if dt := now.Sub(window[0].at).Seconds(); dt > 0 {
+			r.DirsPerSec = math.Round(float64(last.NumDirs-window[0].dirs) / dt)
+			r.BytesPerSec = math.Round(float64(last.BytesTotal-window[0].bytes) / dt)
+		}
+		if expect > 0 {
+			// The used space also covers what the scan skips, so the
+			// estimate never claims to be done.
+			r.Percent = math.Min(99, float64(last.BytesTotal)*100/float64(expect))
+			if r.BytesPerSec > 0 && last.BytesTotal < expect {
+				r.ETASeconds = math.Round(float64(expect-last.BytesTotal) / r.BytesPerSec)
+			}
+		}
+		return r
+	}
+	enc := json.NewEncoder(os.Stderr)
+	finish := func() {
+		if asJSON {
+			enc.Encode(rate())
+		} else {
+			fmt.Fprintf(os.Stderr, "\r\033[K")
+		}
+		done <- struct{}{}
+	}
 	for {
 		select {
 		case <-ctx.Done():
-			fmt.Printf("\r\033[K")
-			done <- struct{}{}
+			finish()
 			return
 		case u, ok := <-prog:
 			if !ok {
-				fmt.Printf("\r\033[K")
-				done <- struct{}{}
+				finish()
 				return
 			}
 			last = u
 		case <-tick.C:
-			fmt.Printf("\r\033[K%sScanning:%s %s%-40s%s | %sDirs:%s %d | %sSize:%s %s",
-				ColorCyan, ColorReset, Bold, shortenPath(last.CurrentDir, 40), ColorReset,
-				ColorYellow, ColorReset, last.NumDirs,
-				ColorGreen, ColorReset, formatSize(last.BytesTotal))
+			r := rate()
+			if asJSON {
+				enc.Encode(r)
+				continue
+			}
+			eta := ""
+			if expect > 0 {
+				eta = fmt.Sprintf(" | ~%.0f%%", r.Percent)
+				if r.ETASeconds > 0 {
+					eta += fmt.Sprintf(" ETA %s", time.Duration(r.ETASeconds)*time.Second)
+				}
+			}
+			fmt.Fprintf(os.Stderr, "\r\033[K%sScanning:%s %s%s%s | %sDirs:%s %d (%.0f/s) | %sSize:%s %s (%s/s)%s",
+				color(ColorCyan), color(ColorReset), color(Bold), padRight(shortenPath(last.CurrentDir, 40), 40), color(ColorReset),
+				color(ColorYellow), color(ColorReset), last.NumDirs, r.DirsPerSec,
+				color(ColorGreen), color(ColorReset), formatSize(last.BytesTotal), formatSize(int64(r.BytesPerSec)), eta)
+		}
+	}
+}
+
+// printPlan prints what a scan of root with opts would do with each of its
+// immediate subdirectories.
+func printPlan(root string, opts scanner.Options) error {
+	plan, err := scanner.Plan(root, opts)
+	if err != nil {
+		return err
+	}
+	skipped := 0
+	fmt.Fprintf(stdout, "Plan for '%s':\n", root)
+	for _, e := range plan {
+		if e.Reason == "" {
+			fmt.Fprintf(stdout, "   %sscan%s  %s\n", color(ColorGreen), color(ColorReset), e.Path)
+			continue
+		}
+		skipped++
+		fmt.Fprintf(stdout, "   %sskip%s  %s  (%s)\n", color(ColorYellow), color(ColorReset), e.Path, e.Reason)
+	}
+	fmt.Fprintf(stdout, "\n%d to scan, %d skipped\n", len(plan)-skipped, skipped)
+	return nil
+}
+
+// printTopFiles lists the largest individual files found by the scan.
+func printTopFiles(files []scanner.FileEntry) {
+	if len(files) == 0 {
+		return
+	}
+	fmt.Fprintln(stdout, "\nLargest files:")
+	for _, f := range files {
+		fmt.Fprintf(stdout, "   %10s  %s  %s%-12s%s %s\n", formatSize(f.Size), formatDate(f.Mtime),
+			color(getColorForCategory(f.Category)), f.Category, color(ColorReset), f.Path)
+	}
+}
+
+// printDenied summarises the directories that could not be read for lack
+// of permission, with what the previous scan found in them if it could.
+func printDenied(m, prev map[string]*scanner.FolderSize, n int64) {
+	var known int64
+	for p, fs := range m {
+		if fs.SkipReason == scanner.SkipPermission && prev[p] != nil && !prev[p].Skipped {
+			known += prev[p].Total
 		}
 	}
+	line := fmt.Sprintf("\n%s⚠ %s directories unreadable%s (run as root for full coverage)", color(ColorYellow), formatCount(n), color(ColorReset))
+	if known > 0 {
+		line += fmt.Sprintf(", %s in them at the previous scan", formatSize(known))
+	}
+	fmt.Fprintln(stdout, line)
+}
+
+// timedOut tells on stderr that the results are partial when ctx ended
+// because --timeout ran out.
+func timedOut(ctx context.Context, limit time.Duration) {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		fmt.Fprintf(os.Stderr, "Scan stopped by --timeout %s: results are partial\n", limit)
+	}
 }
 
-func printFat(fs *FolderSize, all map[string]*FolderSize, prev map[string]int64) {
-	fmt.Printf("\n%s%s%s  %s  (%d files)\n", Bold, fs.Path, ColorReset, formatSize(fs.Total), fs.FileCount)
+// printFat prints the report block for one directory. days is the time
+// since the previous scan and drives the per-day growth rate; 0 hides it.
+func printFat(fs *scanner.FolderSize, all map[string]*scanner.FolderSize, prev map[string]*scanner.FolderSize, days float64) {
+	size := shownSize(fs)
+	share := ""
+	if disk.Total > 0 {
+		share = fmt.Sprintf("  %.1f%% of disk", float64(size)*100/float64(disk.Total))
+		if disk.Used > 0 {
+			share += fmt.Sprintf(", %.1f%% of used", float64(size)*100/float64(disk.Used))
+		}
+	}
+	if selfOnly && fs.Total != fs.Size {
+		share = fmt.Sprintf("  directly inside, %s with subfolders", formatSize(fs.Total)) + share
+	}
+	fmt.Fprintf(stdout, "\n%s%s%s  %s  (%s files, %s subdirs)%s\n", color(Bold), fs.Path, color(ColorReset), colorSize(size),
+		formatCount(fs.FileCount), formatCount(fs.SubdirCount), share)
 	if !fs.Oldest.IsZero() {
-		fmt.Printf("   date span: %s – %s\n", fs.Oldest.Format("2006-01-02"), fs.Newest.Format("2006-01-02"))
+		fmt.Fprintf(stdout, "   date span: %s – %s\n", formatDate(fs.Oldest), formatDate(fs.Newest))
 	}
 	avg := int64(0)
 	if fs.FileCount > 0 {
-		avg = fs.Total / fs.FileCount
+		avg = (fs.Total - fs.DirBytes) / fs.FileCount
 	}
-	if avg < 64<<10 && fs.FileCount > 1000 {
-		fmt.Printf("   ⚠ many tiny files (avg %.0f KB)\n", float64(avg)/(1<<10))
+	if advise && avg < tinyAvg && fs.FileCount > tinyCount {
+		fmt.Fprintf(stdout, "   ⚠ many tiny files (avg %s)\n", formatSize(avg))
 	}
-	fmt.Printf("   mix: %s\n", formatFileTypeRatios(fs.FileTypes, fs.Total))
 	kids := directChildren(all, fs.Path)
+	if fs.Size > 0 && len(kids) > 0 && !selfOnly {
+		n := fs.FileCount
+		for _, k := range kids {
+			n -= k.FileCount
+		}
+		fmt.Fprintf(stdout, "   files directly inside: %s in %s files\n", formatSize(fs.Size), formatCount(n))
+	}
+	if onDisk := fs.Total - fs.DirBytes; fs.Logical > 0 && onDisk*10 < fs.Logical*9 {
+		fmt.Fprintf(stdout, "   ⇲ compressed or sparse: %s of files on %s of disk, saving %.0f%%\n", formatSize(fs.Logical), formatSize(onDisk),
+			float64(fs.Logical-onDisk)*100/float64(fs.Logical))
+	}
+	if fs.DirBytes > 0 {
+		fmt.Fprintf(stdout, "   directories themselves: %s of that in %s directories\n", formatSize(fs.DirBytes), formatCount(fs.SubdirCount+1))
+	}
+	if advise && manySubdirs > 0 && len(kids) >= manySubdirs {
+		fmt.Fprintf(stdout, "   ⚠ %s subfolders directly inside\n", formatCount(int64(len(kids))))
+	}
+	if fs.Skipped {
+		why := fs.SkipReason
+		if fs.SkipError != "" {
+			why = fs.SkipError
+		}
+		fmt.Fprintf(stdout, "   ⚠ not fully scanned (%s)\n", why)
+	} else if fs.Partial {
+		fmt.Fprintf(stdout, "   ⚠ files counted only partially (%s), subfolders complete\n", fs.SkipReason)
+	}
+	if suggestCleanup {
+		if pat := cacheMatch(fs.Path); pat != "" {
+			fmt.Fprintf(stdout, "   %s♻ likely a cache (%s), likely safe to delete%s\n", color(ColorYellow), pat, color(ColorReset))
+		}
+	}
+	fmt.Fprintf(stdout, "   mix: %s\n", formatFileTypeRatios(fs.FileTypes, fs.Total-fs.DirBytes))
 	if len(kids) > 0 {
-		sort.Slice(kids, func(i, j int) bool { return kids[i].Total > kids[j].Total })
+		sort.Slice(kids, func(i, j int) bool {
+			if kids[i].Total != kids[j].Total {
+				return kids[i].Total > kids[j].Total
+			}
+			return kids[i].Path < kids[j].Path
+		})
 		dom := float64(kids[0].Total) / float64(fs.Total)
-		if dom > 0.8 {
-			fmt.Printf("   ↳ dominant: %s (%s, %.1f%%)\n", filepath.Base(kids[0].Path), formatSize(kids[0].Total), dom*100)
+		if dom*100 > dominantPct {
+			fmt.Fprintf(stdout, "   ↳ dominant: %s (%s, %.1f%%)\n", filepath.Base(kids[0].Path), formatSize(kids[0].Total), dom*100)
 		} else {
-			fmt.Println("   top sub-folders:")
+			fmt.Fprintln(stdout, "   top sub-folders:")
 			for i, k := range kids {
-				if i >= 5 || float64(k.Total)/float64(fs.Total) < 0.05 {
+				if childLimit > 0 && i >= childLimit || float64(k.Total)*100/float64(fs.Total) < childMinPct {
 					break
 				}
-				fmt.Printf("      • %-30s %6.1f%%  %s\n", filepath.Base(k.Path), float64(k.Total)*100/float64(fs.Total), formatSize(k.Total))
+				frac := float64(k.Total) / float64(fs.Total)
+				fmt.Fprintf(stdout, "      • %s %6.1f%%  %s%s\n", padRight(filepath.Base(k.Path), 30), frac*100, bar(frac), formatSize(k.Total))
 			}
 		}
 	}
-	if old, ok := prev[fs.Path]; ok && old != fs.Total {
-		diff := fs.Total - old
-		sign := "+"
-		if diff < 0 {
-			sign = ""
+	if old, ok := prev[fs.Path]; ok && (old.Total != fs.Total || old.FileCount != fs.FileCount && old.FileTypes != nil) {
+		line := fmt.Sprintf("   growth: %s (%s)", signedSize(fs.Total-old.Total), formatSize(old.Total))
+		if days > 0 {
+			line += fmt.Sprintf(", %s/day", signedSize(int64(float64(fs.Total-old.Total)/days)))
+		}
+		if old.FileTypes != nil {
+			if dn := fs.FileCount - old.FileCount; dn != 0 {
+				line += fmt.Sprintf(", %s files", signedCount(dn))
+			}
+			if c, d := largestTypeChange(old, fs); d != 0 {
+				line += fmt.Sprintf(", %s of %s", signedSize(d), c)
+			}
 		}
-		fmt.Printf("   growth: %s%s (%s)\n", sign, formatSize(diff), formatSize(old))
+		fmt.Fprintln(stdout, line)
+	} else if ok && old.Fingerprint != "" && fs.Fingerprint != "" && old.Fingerprint != fs.Fingerprint {
+		fmt.Fprintf(stdout, "   %s⟳ same size as last scan, but the files directly inside changed%s\n", color(ColorYellow), color(ColorReset))
 	}
 }
 
-func main() {
-	help := flag.Bool("help", false, "")
-	vers := flag.Bool("version", false, "")
-	topN := flag.Int("top", 15, "")
-	slow := flag.Duration("slow-threshold", 2*time.Second, "")
-	minSizeStr := flag.String("min-size", "100G", "")
-	var exclude multiFlag
-	flag.Var(&exclude, "exclude", "")
-	flag.Parse()
-	if *help {
-		flag.Usage()
-		return
+// largestTypeChange returns the category whose byte count moved the most
+// between two records of the same directory.
+func largestTypeChange(old, cur *scanner.FolderSize) (string, int64) {
+	var best string
+	var delta int64
+	for _, c := range scanner.KnownCategories() {
+		d := cur.FileTypes[c] - old.FileTypes[c]
+		if d*d > delta*delta {
+			best, delta = c, d
+		}
 	}
-	if *vers {
-		fmt.Println("find-large-dirs", version)
-		return
+	return best, delta
+}
+
+// printGrowthRates prints the root's growth per day since the previous scan
+// and the five directories that grew fastest.
+func printGrowthRates(all, prev map[string]*scanner.FolderSize, root string, days float64) {
+	if cur, old := all[root], prev[root]; cur != nil && old != nil {
+		fmt.Fprintf(stdout, "\nGrowth rate: %s/day for %s\n", signedSize(int64(float64(cur.Total-old.Total)/days)), root)
 	}
-	root := "/"
-	if flag.NArg() > 0 {
-		root = flag.Arg(0)
+	var fastest []dirChange
+	for _, c := range diffSnapshots(prev, all) {
+		if c.Status == "grown" {
+			fastest = append(fastest, c)
+		}
+		if len(fastest) == 5 {
+			break
+		}
 	}
-	minBytes, err := parseSize(*minSizeStr)
-	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
+	if len(fastest) == 0 {
 		return
 	}
-	prevMap, prevTime := loadPrev(dbPath())
-	ctx, cancel := context.WithCancel(context.Background())
-	sig := make(chan os.Signal, 1)
-	signal.Notify(sig, os.Interrupt)
-	go func() {
-		<-sig
-		fmt.Fprintln(os.Stderr, "\nInterrupted – finalising…")
-		cancel()
-	}()
-	prog := make(chan progressUpdate, 16)
-	done := make(chan struct{})
-	go progressReporter(ctx, prog, done)
-	fmt.Printf("Scanning '%s'…\n\n", root)
-	m := bfsScan(ctx, root, exclude, *slow, prog)
-	close(prog)
-	<-done
-	fmt.Println()
-	aggregateTotals(m)
-	var fat []*FolderSize
-	for _, fs := range m {
-		if fs.Path == root {
-			continue
-		}
-		if fs.Total >= minBytes {
-			fat = append(fat, fs)
+	fmt.Fprintln(stdout, "Fastest growing:")
+	for _, c := range fastest {
+		fmt.Fprintf(stdout, "   %s%12s/day%s  %s\n", color(ColorRed), signedSize(int64(float64(c.New-c.Old)/days)), color(ColorReset), c.Path)
+	}
+}
+
+// rawLookup finds the record of p in m, taking a relative p as relative to
+// the working directory first and to root second. Excluded directories
+// count as not found.
+func rawLookup(m map[string]*scanner.FolderSize, root, p string) *scanner.FolderSize {
+	cands := []string{expandPath(p)}
+	if !filepath.IsAbs(p) {
+		cands = append(cands, filepath.Join(root, p))
+	}
+	for _, c := range cands {
+		if fs := m[c]; fs != nil && fs.SkipReason != scanner.SkipExcluded {
+			return fs
 		}
 	}
-	sort.Slice(fat, func(i, j int) bool { return fat[i].Total > fat[j].Total })
-	if len(fat) == 0 {
-		for _, fs := range m {
-			if fs.Path == root {
-				continue
+	return nil
+}
+
+// fileRecord turns the file f given as the root into the record of a
+// directory holding only f, for the writers of the machine formats.
+func fileRecord(f scanner.FileEntry) *scanner.FolderSize {
+	return &scanner.FolderSize{
+		Path: f.Path, Size: f.Size, Total: f.Size, FileCount: 1, Oldest: f.Mtime, Newest: f.Mtime,
+		FileTypes: map[string]int64{f.Category: f.Size}, TypeCounts: map[string]int64{f.Category: 1},
+	}
+}
+
+// printRemoved lists the directories under root that reached minBytes at
+// the previous scan but no longer do, largest first, at most top of them.
+func printRemoved(all, prev map[string]*scanner.FolderSize, root string, minBytes int64, top int) {
+	var gone []*scanner.FolderSize
+	for p, old := range prev {
+		if p == root || old.Total < minBytes || relDepth(root, p) < 0 {
+			continue
+		}
+		if cur := all[p]; cur == nil || cur.Total < minBytes {
+			gone = append(gone, old)
+		}
+	}
+	if len(gone) == 0 {
+		return
+	}
+	sort.Slice(gone, func(i, j int) bool {
+		if gone[i].Total != gone[j].Total {
+			return gone[i].Total > gone[j].Total
+		}
+		return gone[i].Path < gone[j].Path
+	})
+	if len(gone) > top {
+		gone = gone[:top]
+	}
+	fmt.Fprintln(stdout, "\nRecently shrunk/removed:")
+	for _, old := range gone {
+		now := "removed"
+		if cur := all[old.Path]; cur != nil {
+			now = "now " + formatSize(cur.Total)
+		}
+		fmt.Fprintf(stdout, "   %s%12s%s → %-12s %s\n", color(ColorGreen), formatSize(old.Total), color(ColorReset), now, old.Path)
+	}
+}
+
+// printTree renders the directories at or above minBytes as an indented
+// tree under root, each with its share of the parent's total.
+func printTree(root string, all map[string]*scanner.FolderSize, minBytes int64, less func(a, b *scanner.FolderSize) bool) {
+	kids := map[string][]*scanner.FolderSize{}
+	for p, fs := range all {
+		if par := filepath.Dir(p); par != p && fs.Total >= minBytes {
+			kids[par] = append(kids[par], fs)
+		}
+	}
+	top := all[root]
+	if top == nil {
+		return
+	}
+	fmt.Fprintf(stdout, "\n%s%s%s  %s\n", color(Bold), top.Path, color(ColorReset), formatSize(top.Total))
+	var walk func(fs *scanner.FolderSize, indent string)
+	walk = func(fs *scanner.FolderSize, indent string) {
+		ks := kids[fs.Path]
+		sort.Slice(ks, func(i, j int) bool { return less(ks[i], ks[j]) })
+		for i, k := range ks {
+			branch, next := "├── ", "│   "
+			if i == len(ks)-1 {
+				branch, next = "└── ", "    "
+			}
+			pct := 0.0
+			if fs.Total > 0 {
+				pct = float64(k.Total) * 100 / float64(fs.Total)
+			}
+			fmt.Fprintf(stdout, "%s%s%s  %s  %s%.1f%%%s\n", indent, branch, filepath.Base(k.Path), formatSize(k.Total), color(ColorGreen), pct, color(ColorReset))
+			walk(k, indent+next)
+		}
+	}
+	walk(top, "")
+}
+
+// printPerParent lists, for every directory at or above minBytes that has
+// subfolders, its n largest children, going down the tree by path. Unlike
+// the global top list, one huge subtree cannot crowd out the others.
+func printPerParent(all map[string]*scanner.FolderSize, n int, minBytes int64, less func(a, b *scanner.FolderSize) bool) {
+	var parents []*scanner.FolderSize
+	for _, fs := range all {
+		if fs.Total >= minBytes && fs.SubdirCount > 0 {
+			parents = append(parents, fs)
+		}
+	}
+	sort.Slice(parents, func(i, j int) bool { return parents[i].Path < parents[j].Path })
+	for _, par := range parents {
+		var kids []*scanner.FolderSize
+		for _, k := range directChildren(all, par.Path) {
+			if k.Total > 0 {
+				kids = append(kids, k)
+			}
+		}
+		if len(kids) == 0 {
+			continue
+		}
+		sort.Slice(kids, func(i, j int) bool { return less(kids[i], kids[j]) })
+		fmt.Fprintf(stdout, "\n%s%s%s  %s\n", color(Bold), par.Path, color(ColorReset), colorSize(par.Total))
+		for i, k := range kids {
+			if i >= n {
+				var rest int64
+				for _, r := range kids[i:] {
+					rest += r.Total
+				}
+				fmt.Fprintf(stdout, "   … and %s more (%s)\n", formatCount(int64(len(kids)-i)), formatSize(rest))
+				break
+			}
+			frac := float64(k.Total) / float64(par.Total)
+			fmt.Fprintf(stdout, "   %s %6.1f%%  %s%s\n", padRight(filepath.Base(k.Path), 30), frac*100, bar(frac), formatSize(k.Total))
+		}
+	}
+}
+
+// Exit codes besides 0 (success), 1 (the scan could not run) and 2 (bad
+// usage). When several apply, the lowest wins.
+const (
+	exitAlert      = 3 // a directory reached --alert-size
+	exitScanErrors = 4 // some directories could not be read
+	exitPartial    = 5 // interrupted or stopped by --timeout
+)
+
+// exitStatus picks the exit code for a finished scan of root.
+func exitStatus(ctx context.Context, m map[string]*scanner.FolderSize, root string, alert int64) int {
+	code := 0
+	var over []*scanner.FolderSize
+	for _, fs := range m {
+		if alert > 0 && fs.Total >= alert && relDepth(root, fs.Path) > 0 {
+			over = append(over, fs)
+		}
+		if code == 0 && (fs.SkipReason == scanner.SkipPermission || fs.SkipReason == scanner.SkipReadError) {
+			code = exitScanErrors
+		}
+	}
+	if ctx.Err() != nil && code == 0 {
+		code = exitPartial
+	}
+	if len(over) > 0 {
+		sort.Slice(over, func(i, j int) bool {
+			if over[i].Total != over[j].Total {
+				return over[i].Total > over[j].Total
+			}
+			return over[i].Path < over[j].Path
+		})
+		fmt.Fprintf(os.Stderr, "alert: %d directories reached %s, largest %s (%s)\n",
+			len(over), formatSize(alert), over[0].Path, formatSize(over[0].Total))
+		code = exitAlert
+	}
+	return code
+}
+
+func main() {
+	code := 0
+	defer func() {
+		if code != 0 {
+			os.Exit(code)
+		}
+	}()
+	help := flag.Bool("help", false, "")
+	vers := flag.Bool("version", false, "")
+	topN := flag.Int("top", 15, "")
+	summaryOut := flag.Bool("summary", false, "print the totals of the scan as one JSON object; with --json it is added under \"summary\", with --ndjson as a last line of type \"summary\"")
+	offset := flag.Int("offset", 0, "skip the first N directories of the sorted results, to page through them with --top or --max-results")
+	maxResults := flag.Int("max-results", 0, "cap the directories written as JSON, CSV, NDJSON, compact lines or Prometheus metrics (0: all that reach --min-size, all for NDJSON); NDJSON keeps the first N in scan order")
+	slow := flag.Duration("slow-threshold", 2*time.Second, "")
+	slowDir := flag.Duration("slow-dir-threshold", 0, "skip a directory and everything below it when listing its entries takes longer than this (0 disables)")
+	workers := flag.Int("workers", runtime.NumCPU(), "number of directories read in parallel")
+	minSizeStr := flag.String("min-size", "100G", "")
+	theme := flag.String("theme", "default", "color theme: default, colorblind (hues that stay apart, plus ▲ markers on large sizes) or mono")
+	themeCfg := flag.String("theme-config", "", "JSON `file` mapping categories to colors (names or 256-color numbers), e.g. {\"Video\": \"208\"}")
+	colorMode := flag.String("color", "auto", "colorize output: auto (only on a terminal), always or never")
+	noColor := flag.Bool("no-color", false, "same as --color=never")
+	interactive := flag.Bool("interactive", false, "browse the results in a full-screen view after the scan")
+	tree := flag.Bool("tree", false, "print directories at or above --min-size as a tree under the root")
+	perParent := flag.Int("top-per-parent", 0, "instead of one top list, show the N largest subfolders of every directory at or above --min-size (--max-depth limits how deep)")
+	baselineURL := flag.String("baseline-url", "", "compare with a history file fetched over HTTP instead of the local one, which is still updated")
+	baselineToken := flag.String("baseline-token", "", "bearer token for --baseline-url (default $FIND_LARGE_DIRS_BASELINE_TOKEN)")
+	baselineTimeout := flag.Duration("baseline-timeout", 30*time.Second, "give up fetching --baseline-url after this long")
+	dbFlag := flag.String("db", "", "history file (default $FIND_LARGE_DIRS_DB or ~/.find-large-dirs/db.json); a .gz name stores it gzip-compressed")
+	noDB := flag.Bool("no-db", false, "neither read nor update the scan history")
+	snapshot := flag.String("snapshot", "", "also save this scan as a named snapshot next to the db")
+	compare := flag.String("compare", "", "diff two named snapshots without scanning: --compare A B")
+	classifyCfg := flag.String("classify-config", "", "JSON `file` mapping extensions to categories, merged over the built-in table")
+	var addCats, dropCats multiFlag
+	flag.Var(&dropCats, "exclude-category", "leave files of this category out of all sizes and counts, e.g. Video (repeatable)")
+	flag.Var(&addCats, "add-category", "register a category color as NAME=COLOR (repeatable)")
+	sniff := flag.Bool("sniff", false, "detect the category of unrecognised files from their first bytes")
+	sniffMinStr := flag.String("sniff-min-size", "1M", "only sniff files at least this large")
+	useGitignore := flag.Bool("use-gitignore", false, "skip files and directories ignored by .gitignore files in the scanned tree")
+	watchEvery := flag.Duration("watch", 0, "rescan every `interval` and print what changed since the previous cycle")
+	sortKey := flag.String("sort", "size", "order results by size, count, age or name")
+	reverse := flag.Bool("reverse", false, "invert the --sort order")
+	minFiles := flag.Int64("min-files", 0, "hide directories holding fewer than N files in total")
+	showRemoved := flag.Bool("show-removed", false, "list directories that reached --min-size at the previous scan but no longer do")
+	showEmpty := flag.Bool("show-empty", false, "also list directories whose total size is zero")
+	maxSizeStr := flag.String("max-size", "", "only report directories up to this total size (inclusive)")
+	findDupes := flag.Bool("find-dupes", false, "hash same-size files to report duplicates and the space they waste")
+	dupeMinStr := flag.String("dupe-min-size", "1M", "only look for duplicates among files at least this large")
+	trackChurn := flag.Bool("track-churn", false, "keep a fingerprint of every directory's files in the history to spot contents replaced at the same size (uses more memory)")
+	peekArchives := flag.Bool("peek-archives", false, "list the contents of .zip, .tar and .tar.gz files to show their uncompressed size and type mix (slow)")
+	peekMinStr := flag.String("peek-min-size", "10M", "only look into archives at least this large")
+	sinceStr := flag.String("since", "", "count only files modified after this `time`: RFC 3339, YYYY-MM-DD[ HH:MM] or a duration ago like 24h or 7d")
+	untilStr := flag.String("until", "", "count only files modified before this `time`, in the same forms as --since")
+	olderThanStr := flag.String("older-than", "", "only report directories with nothing modified within this `duration` (e.g. 90d, 2w, 1y)")
+	ageHist := flag.Bool("age-histogram", false, "summarise scanned bytes by last-modified age")
+	dateFmt := flag.String("date-format", "", "Go time `layout` for dates in the report and times in CSV, e.g. '02.01.2006 15:04' (default 2006-01-02, CSV RFC 3339)")
+	flag.BoolVar(&inUTC, "utc", false, "show all times in UTC instead of local time, in JSON and CSV too")
+	units := flag.String("units", "iec", "size units: iec (KiB, MiB, GiB), si (kB, MB, GB, 1000-based) or legacy (1024-based, labelled KB, MB, GB)")
+	si := flag.Bool("si", false, "same as --units=si")
+	noHidden := flag.Bool("no-hidden", false, "skip directories whose name starts with a dot")
+	noHiddenFiles := flag.Bool("no-hidden-files", false, "leave files whose name starts with a dot out of the sizes")
+	timeout := flag.Duration("timeout", 0, "stop scanning after this long and report what was found so far (0 means no limit)")
+	var plan bool
+	flag.BoolVar(&plan, "plan", false, "list the root's subdirectories and which the scan would skip and why, then exit")
+	flag.BoolVar(&plan, "list-roots", false, "same as --plan")
+	fallbackTop := flag.Bool("fallback-top", true, "when no directory reaches --min-size, report the --top largest instead (applies to JSON and CSV too)")
+	noFallback := flag.Bool("no-fallback", false, "same as --fallback-top=false: report nothing when no directory reaches --min-size")
+	alertStr := flag.String("alert-size", "", "exit with status 3 when any directory below the root reaches this size")
+	var alertCats multiFlag
+	flag.Var(&alertCats, "alert-category", "exit with status 3 when a directory holds SIZE or more of a category, as NAME=SIZE, e.g. Log=10G (repeatable)")
+	quiet := flag.Bool("quiet", false, "leave out the banner, the progress line and the trailing notes; print only the report")
+	incremental := flag.Bool("incremental", false, "reuse the db's results for directories whose mtime has not changed instead of reading them again")
+	forceFull := flag.Bool("force-full", false, "read every directory even with --incremental")
+	flag.IntVar(&barWidth, "bar-width", barWidth, "width of the percentage bars; 0 hides them (they are never drawn without colors)")
+	var includeMounts multiFlag
+	flag.Var(&includeMounts, "include-mount", "with -x, still descend into the filesystem mounted at this path (repeatable)")
+	topFiles := flag.Int("top-files", 0, "also list the N largest individual files")
+	minFileStr := flag.String("min-file-size", "0", "only consider files at least this large for --top-files")
+	depth := flag.Int("depth", -1, "report only directories exactly N levels below the root, with their full totals, whatever their size")
+	warnStr := flag.String("warn-size", "10G", "show directory totals from this size in yellow")
+	growthPctStr := flag.String("growth-alert", "", "flag at the top of the report directories that grew by at least this percentage since the previous scan, e.g. 50%")
+	growthSizeStr := flag.String("growth-alert-size", "", "flag at the top of the report directories that grew by at least this much since the previous scan, new ones included")
+	critStr := flag.String("crit-size", "100G", "show directory totals from this size in red")
+	tinyAvgStr := flag.String("tiny-file-avg", "64K", "warn about many tiny files when their average size is below this")
+	flag.Int64Var(&tinyCount, "tiny-file-count", tinyCount, "warn about many tiny files only above this many files")
+	flag.IntVar(&manySubdirs, "many-subdirs", manySubdirs, "warn about directories with at least this many direct subfolders (0 disables)")
+	flag.IntVar(&childLimit, "child-limit", childLimit, "list at most N sub-folders under each directory of the report (0 lists all)")
+	flag.Float64Var(&childMinPct, "child-min-pct", childMinPct, "leave out sub-folders below this percentage of their parent (0 keeps all)")
+	flag.Float64Var(&dominantPct, "dominant-pct", dominantPct, "show only the largest sub-folder when it holds more than this percentage of its parent (100 never does)")
+	noWarnings := flag.Bool("no-warnings", false, "leave out the advisory hints about tiny files and wide directories")
+	flag.BoolVar(&selfOnly, "no-aggregate", false, "rank and filter directories by the files directly inside them, not by their subfolders")
+	flag.BoolVar(&suggestCleanup, "suggest-cleanup", false, "point out directories that look like caches and sum up what deleting them would free")
+	rmScript := flag.String("emit-rm", "", "write a reviewable, non-executable shell `script` with an rm -rf line per likely cache (- for stdout); nothing is deleted")
+	var cacheExtra multiFlag
+	flag.Var(&cacheExtra, "cache-pattern", "also treat directories matching this glob as caches, e.g. .venv or build/tmp (repeatable)")
+	fromNDJSON := flag.String("from-ndjson", "", "build the report from the records of an earlier --ndjson run in `file` instead of scanning")
+	rawPath := flag.String("raw", "", "print only the total size in bytes of `path` (the root when no root is given) and exit 1 if the scan did not reach it")
+	lineFmt := flag.String("format", "", "print each reported directory with this Go text/template `template` instead of the report, e.g. '{{size .Total}} {{.Path}}'; see README for the fields and functions")
+	compact := flag.Bool("compact", false, "print one tab-separated SIZE, FILES, PATH line per reported directory, without colors")
+	promPath := flag.String("prometheus", "", "write the reported directories as Prometheus textfile metrics to `file`")
+	outPath := flag.String("output", "", "write the report, JSON or CSV to `file` instead of stdout (colors off unless --color=always)")
+	byType := flag.Bool("by-type", false, "group the report by file category instead of by directory")
+	progressMode := flag.String("progress", "", "progress display: text, json (JSON lines on stderr) or none (default text, none for machine output)")
+	foldCase := flag.Bool("case-insensitive", scanner.CaseInsensitiveFS, "match --exclude, --exclude-glob, --exclude-regex and the built-in skip list regardless of case (default on Windows and macOS)")
+	var includes multiFlag
+	flag.Var(&includes, "include", "scan only directories matching this glob, e.g. '**/logs', and everything below them (repeatable; excludes still apply)")
+	pathsFrom := flag.String("paths-from", "", "scan only the directories listed in `file`, one per line (- reads stdin), reported under their common parent")
+	var exclude, excludeGlob, excludeRegex multiFlag
+	flag.Var(&exclude, "exclude", "")
+	flag.Var(&excludeGlob, "exclude-glob", "skip directories matching a shell glob; ** spans directories (repeatable)")
+	flag.Var(&excludeRegex, "exclude-regex", "skip directories whose cleaned absolute path matches a regexp (repeatable)")
+	var excludeFrom multiFlag
+	flag.Var(&excludeFrom, "exclude-from", "read exclude patterns from `file`, one per line: prefixes, globs, or regexps prefixed with re: (repeatable)")
+	noDefaultExcl := flag.Bool("no-default-excludes", false, "also scan proc, sys, dev, run, tmp and var directories")
+	var oneFS bool
+	flag.BoolVar(&oneFS, "x", false, "shorthand for --one-file-system")
+	flag.BoolVar(&oneFS, "one-file-system", false, "do not descend into directories on other filesystems")
+	apparent := flag.Bool("apparent-size", false, "count logical file length instead of allocated disk blocks")
+	countLinks := flag.Bool("count-links", false, "count hard-linked files once per link instead of once per inode")
+	followLinks := flag.Bool("follow-symlinks", false, "descend into symlinked directories that resolve inside the root")
+	followExt := flag.Bool("follow-external", false, "with --follow-symlinks, also follow links that leave the root")
+	jsonOut := flag.Bool("json", false, "print the reported directories as a JSON array instead of the report")
+	jsonAll := flag.Bool("json-all", false, "like --json, but include every scanned directory")
+	ndjson := flag.Bool("ndjson", false, "stream each directory as a JSON line while scanning, without aggregation or report")
+	csvPath := flag.String("csv", "", "write the reported directories as CSV to `file` (- for stdout)")
+	showCompression := flag.Bool("show-compression", false, "point out directories whose files take at least 10% less disk space than their size, as with btrfs or ZFS compression or sparse files")
+	dirOverhead := flag.Bool("count-dir-overhead", false, "add the space directories take themselves to the totals, shown apart from file bytes")
+	streaming := flag.Bool("streaming", false, "keep memory flat on huge trees: with --no-aggregate only the largest directories are kept, with --max-depth only the shallow ones; no history is saved")
+	estimate := flag.Bool("estimate", false, "sample the tree for about two seconds before scanning to show a rough percentage and ETA in the progress line when the root is not a whole filesystem")
+	showInodes := flag.Bool("inodes", false, "list the directories holding the most files and directories even when inodes are not running out")
+	benchPath := flag.String("benchmark", "", "scan `path` several times with different worker counts, report the throughput of each and recommend --workers and --slow-threshold, then exit")
+	retries := flag.Int("retries", 2, "read a directory up to N more times after a transient network filesystem error such as a stale NFS handle or a timeout before skipping it")
+	retryDelay := flag.Duration("retry-delay", 200*time.Millisecond, "wait this long before the first retry, doubling before each further one")
+	maxDepth := flag.Int("max-depth", -1, "fold directories deeper than N levels below the root into their ancestor (0 keeps only the root, -1 is unlimited)")
+	flag.String("config", "", "read default options from this JSON `file` (default $XDG_CONFIG_HOME/find-large-dirs/config.json)")
+	flag.Bool("no-config", false, "ignore the config file")
+	if path, explicit, disabled := configFromArgs(os.Args[1:]); !disabled && path != "" {
+		if err := loadConfig(path, explicit); err != nil {
+			fmt.Fprintln(os.Stderr, "config:", err)
+			os.Exit(2)
+		}
+	}
+	flag.Parse()
+	if *help {
+		flag.Usage()
+		return
+	}
+	if *vers {
+		fmt.Fprintln(stdout, "find-large-dirs", version)
+		return
+	}
+	root := "/"
+	if flag.NArg() > 0 {
+		root = flag.Arg(0)
+	} else if *rawPath != "" {
+		root = *rawPath
+	} else if *benchPath != "" {
+		root = *benchPath
+	}
+	root = expandPath(root)
+	if *dateFmt != "" {
+		dateLayout, timeLayout = *dateFmt, *dateFmt
+	}
+	switch *units {
+	case "iec", "si", "legacy":
+		sizeUnits = *units
+	default:
+		fmt.Fprintf(os.Stderr, "--units: unknown mode %q (want iec, si or legacy)\n", *units)
+		os.Exit(2)
+	}
+	if *si {
+		sizeUnits = "si"
+	}
+	if *showCompression && *apparent {
+		fmt.Fprintln(os.Stderr, "--show-compression compares with the space on disk and cannot be combined with --apparent-size")
+		os.Exit(2)
+	}
+	if *offset < 0 {
+		fmt.Fprintln(os.Stderr, "--offset: must not be negative")
+		os.Exit(2)
+	}
+	var format *lineFormat
+	if *lineFmt != "" {
+		if *compact || *jsonOut || *jsonAll || *ndjson {
+			fmt.Fprintln(os.Stderr, "--format cannot be combined with --compact, --json, --json-all or --ndjson")
+			os.Exit(2)
+		}
+		var err error
+		if format, err = parseFormat(*lineFmt); err != nil {
+			fmt.Fprintln(os.Stderr, "--format:", err)
+			os.Exit(2)
+		}
+	}
+	if *benchPath != "" && flag.NArg() > 0 {
+		fmt.Fprintln(os.Stderr, "--benchmark takes the directory to benchmark itself; drop the other path")
+		os.Exit(2)
+	}
+	if *retries < 0 || *retryDelay < 0 {
+		fmt.Fprintln(os.Stderr, "--retries and --retry-delay must not be negative")
+		os.Exit(2)
+	}
+	minBytes, err := parseSize(*minSizeStr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	sniffMin, err := parseSize(*sniffMinStr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "--sniff-min-size:", err)
+		os.Exit(2)
+	}
+	peekMin, err := parseSize(*peekMinStr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "--peek-min-size:", err)
+		os.Exit(2)
+	}
+	dupeMin, err := parseSize(*dupeMinStr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "--dupe-min-size:", err)
+		os.Exit(2)
+	}
+	var since, until time.Time
+	if *sinceStr != "" {
+		if since, err = parseTime(*sinceStr, time.Now()); err != nil {
+			fmt.Fprintln(os.Stderr, "--since:", err)
+			os.Exit(2)
+		}
+	}
+	if *untilStr != "" {
+		if until, err = parseTime(*untilStr, time.Now()); err != nil {
+			fmt.Fprintln(os.Stderr, "--until:", err)
+			os.Exit(2)
+		}
+	}
+	if !since.IsZero() && !until.IsZero() && until.Before(since) {
+		fmt.Fprintf(os.Stderr, "--until %s is before --since %s\n", until.Format(time.RFC3339), since.Format(time.RFC3339))
+		os.Exit(2)
+	}
+	var olderThan time.Duration
+	if *olderThanStr != "" {
+		if olderThan, err = parseAge(*olderThanStr); err != nil {
+			fmt.Fprintln(os.Stderr, "--older-than:", err)
+			os.Exit(2)
+		}
+	}
+	minFileBytes, err := parseSize(*minFileStr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "--min-file-size:", err)
+		os.Exit(2)
+	}
+	var growthPct float64
+	if *growthPctStr != "" {
+		if growthPct, err = parsePercent(*growthPctStr); err != nil {
+			fmt.Fprintln(os.Stderr, "--growth-alert:", err)
+			os.Exit(2)
+		}
+	}
+	var growthBytes int64
+	if *growthSizeStr != "" {
+		if growthBytes, err = parseSize(*growthSizeStr); err != nil {
+			fmt.Fprintln(os.Stderr, "--growth-alert-size:", err)
+			os.Exit(2)
+		}
+	}
+	if warnBytes, err = parseSize(*warnStr); err != nil {
+		fmt.Fprintln(os.Stderr, "--warn-size:", err)
+		os.Exit(2)
+	}
+	if critBytes, err = parseSize(*critStr); err != nil {
+		fmt.Fprintln(os.Stderr, "--crit-size:", err)
+		os.Exit(2)
+	}
+	if tinyAvg, err = parseSize(*tinyAvgStr); err != nil {
+		fmt.Fprintln(os.Stderr, "--tiny-file-avg:", err)
+		os.Exit(2)
+	}
+	advise = !*noWarnings
+	for _, c := range cacheExtra {
+		if _, err := path.Match(c, ""); err != nil {
+			fmt.Fprintf(os.Stderr, "--cache-pattern %q: %v\n", c, err)
+			os.Exit(2)
+		}
+	}
+	cachePatterns = append(cachePatterns, cacheExtra...)
+	var alertBytes int64
+	if *alertStr != "" {
+		if alertBytes, err = parseSize(*alertStr); err != nil {
+			fmt.Fprintln(os.Stderr, "--alert-size:", err)
+			os.Exit(2)
+		}
+	}
+	maxBytes := int64(math.MaxInt64)
+	if *maxSizeStr != "" {
+		if maxBytes, err = parseSize(*maxSizeStr); err != nil {
+			fmt.Fprintln(os.Stderr, "--max-size:", err)
+			os.Exit(2)
+		}
+		if minBytes > maxBytes {
+			fmt.Fprintf(os.Stderr, "--min-size %s is larger than --max-size %s\n", formatSize(minBytes), formatSize(maxBytes))
+			os.Exit(2)
+		}
+	}
+	switch *colorMode {
+	case "auto":
+		useColor = *outPath == "" && isTerminal(os.Stdout)
+	case "always":
+		useColor = true
+	case "never":
+		useColor = false
+	default:
+		fmt.Fprintf(os.Stderr, "--color: unknown mode %q (want auto, always or never)\n", *colorMode)
+		os.Exit(2)
+	}
+	if *noColor {
+		useColor = false
+	}
+	if err := setTheme(*theme); err != nil {
+		fmt.Fprintln(os.Stderr, "--theme:", err)
+		os.Exit(2)
+	}
+	if *themeCfg != "" {
+		if err := loadThemeConfig(*themeCfg); err != nil {
+			fmt.Fprintln(os.Stderr, "--theme-config:", err)
+			os.Exit(2)
+		}
+	}
+	for _, v := range addCats {
+		if err := parseCategoryColor(v); err != nil {
+			fmt.Fprintln(os.Stderr, "--add-category:", err)
+			os.Exit(2)
+		}
+	}
+	if *classifyCfg != "" {
+		if err := scanner.LoadClassifyConfig(*classifyCfg); err != nil {
+			fmt.Fprintln(os.Stderr, "--classify-config:", err)
+			os.Exit(2)
+		}
+	}
+	known := scanner.KnownCategories()
+	for i, c := range dropCats {
+		found := false
+		for _, k := range known {
+			if strings.EqualFold(c, k) {
+				dropCats[i], found = k, true
+				break
+			}
+		}
+		if !found {
+			fmt.Fprintf(os.Stderr, "--exclude-category: unknown category %q (known: %s)\n", c, strings.Join(known, ", "))
+			os.Exit(2)
+		}
+	}
+	var catLimits []categoryLimit
+	for _, v := range alertCats {
+		l, err := parseCategoryLimit(v, known)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "--alert-category:", err)
+			os.Exit(2)
+		}
+		catLimits = append(catLimits, l)
+	}
+	switch *progressMode {
+	case "", "text", "json", "none":
+	default:
+		fmt.Fprintf(os.Stderr, "--progress: unknown mode %q (want text, json or none)\n", *progressMode)
+		os.Exit(2)
+	}
+	less, err := folderLess(*sortKey, *reverse)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "--sort:", err)
+		os.Exit(2)
+	}
+	for _, g := range excludeGlob {
+		if err := scanner.ValidGlob(g); err != nil {
+			fmt.Fprintf(os.Stderr, "--exclude-glob %q: %v\n", g, err)
+			os.Exit(2)
+		}
+	}
+	for _, g := range includes {
+		if err := scanner.ValidGlob(g); err != nil {
+			fmt.Fprintf(os.Stderr, "--include %q: %v\n", g, err)
+			os.Exit(2)
+		}
+	}
+	// --paths-from becomes one exact --include per directory, so that
+	// nested and repeated entries are walked and counted once.
+	var pathList []string
+	if *pathsFrom != "" {
+		if pathList, err = readPathList(*pathsFrom); err != nil {
+			fmt.Fprintln(os.Stderr, "--paths-from:", err)
+			os.Exit(2)
+		}
+		if len(pathList) == 0 {
+			fmt.Fprintln(os.Stderr, "--paths-from: no directories to scan")
+			os.Exit(2)
+		}
+		if flag.NArg() == 0 {
+			root = commonDir(pathList)
+		}
+		for _, p := range pathList {
+			if relDepth(root, p) < 0 {
+				fmt.Fprintf(os.Stderr, "--paths-from: %s is outside %s and will not be scanned\n", p, root)
+			}
+			includes = append(includes, globEscape(p))
+		}
+	}
+	var excludeRe []*regexp.Regexp
+	for _, e := range excludeRegex {
+		re, err := regexp.Compile(e)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "--exclude-regex %q: %v\n", e, err)
+			os.Exit(2)
+		}
+		excludeRe = append(excludeRe, re)
+	}
+	if *outPath != "" {
+		f, err := os.Create(*outPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "--output:", err)
+			os.Exit(1)
+		}
+		ew := &errWriter{w: f}
+		stdout = ew
+		defer func() {
+			if err := f.Close(); ew.err == nil {
+				ew.err = err
 			}
+			if ew.err != nil {
+				fmt.Fprintln(os.Stderr, "--output:", ew.err)
+				os.Exit(1)
+			}
+		}()
+	}
+	if *quiet {
+		*progressMode = "none"
+	}
+	for i, e := range exclude {
+		exclude[i] = expandPath(e)
+	}
+	baseExcludes := scanner.ExcludeRules{
+		Prefixes:   exclude,
+		Globs:      excludeGlob,
+		Regexps:    excludeRe,
+		NoDefaults: *noDefaultExcl,
+	}
+	if *foldCase {
+		baseExcludes = baseExcludes.CaseInsensitive()
+	}
+	// loadExcludes adds the --exclude-from files to the command-line
+	// rules; --watch calls it again before every cycle.
+	loadExcludes := func() (scanner.ExcludeRules, error) {
+		r := baseExcludes
+		for _, f := range excludeFrom {
+			fr, err := scanner.ReadExcludeFile(f)
+			if err != nil {
+				return baseExcludes, err
+			}
+			for i, e := range fr.Prefixes {
+				fr.Prefixes[i] = expandPath(e)
+			}
+			if *foldCase {
+				fr = fr.CaseInsensitive()
+			}
+			r = r.With(fr)
+		}
+		return r, nil
+	}
+	excludes, err := loadExcludes()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "--exclude-from:", err)
+		os.Exit(2)
+	}
+	db := dbPath(*dbFlag)
+	if *noDB {
+		db = ""
+	}
+	if *compare != "" {
+		if flag.NArg() != 1 {
+			fmt.Fprintln(os.Stderr, "--compare needs two snapshot names: --compare A B")
+			os.Exit(2)
+		}
+		if err := compareSnapshots(dbPath(*dbFlag), *compare, flag.Arg(0), *topN); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	var snapFile string
+	if *snapshot != "" {
+		if snapFile, err = snapshotPath(dbPath(*dbFlag), *snapshot); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+	}
+	// loaded holds the records read with --from-ndjson; the filesystem is
+	// then left alone.
+	var loaded map[string]*scanner.FolderSize
+	if *fromNDJSON != "" {
+		if plan || *watchEvery > 0 || *ndjson {
+			fmt.Fprintln(os.Stderr, "--from-ndjson cannot be combined with --plan, --watch or --ndjson")
+			os.Exit(2)
+		}
+		var first string
+		if loaded, first, err = loadNDJSON(*fromNDJSON); err != nil {
+			fmt.Fprintln(os.Stderr, "--from-ndjson:", err)
+			os.Exit(1)
+		}
+		if flag.NArg() == 0 {
+			root = first
+		}
+		for p := range loaded {
+			if relDepth(root, p) < 0 {
+				delete(loaded, p)
+			}
+		}
+		db = ""
+	}
+	// --streaming drops every record it does not report, which leaves
+	// nothing to roll up: it needs a report that does without that.
+	if *streaming {
+		if !selfOnly && *maxDepth < 0 {
+			fmt.Fprintln(os.Stderr, "--streaming needs --no-aggregate or --max-depth")
+			os.Exit(2)
+		}
+		if *interactive || *tree || *byType || *jsonAll || *rawPath != "" || *snapshot != "" || loaded != nil {
+			fmt.Fprintln(os.Stderr, "--streaming cannot be combined with --interactive, --tree, --by-type, --json-all, --raw, --snapshot or --from-ndjson")
+			os.Exit(2)
+		}
+		db = ""
+	}
+	prevMap, prevHdr := loadPrev(db)
+	if prevHdr.Partial {
+		// Partial scans are saved next to the history, so only a file
+		// written by an older version gets here. Comparing with it would
+		// report whatever it missed as new.
+		fmt.Fprintf(os.Stderr, "note: %s holds an interrupted scan; not comparing with it\n", db)
+		prevMap, prevHdr = map[string]*scanner.FolderSize{}, dbData{}
+	}
+	// The local history still drives --incremental: a baseline from
+	// elsewhere says nothing about which directories here are unchanged.
+	localPrev, localHdr := prevMap, prevHdr
+	if *baselineURL != "" {
+		// The token is read from the environment here rather than as the
+		// flag default, which --help would print.
+		if *baselineToken == "" {
+			*baselineToken = os.Getenv("FIND_LARGE_DIRS_BASELINE_TOKEN")
+		}
+		if prevMap, prevHdr, err = fetchBaseline(*baselineURL, *baselineToken, *baselineTimeout); err != nil {
+			fmt.Fprintln(os.Stderr, "--baseline-url:", err)
+			os.Exit(1)
+		}
+		if prevHdr.Partial {
+			fmt.Fprintln(os.Stderr, "--baseline-url: the baseline is from an interrupted scan")
+			os.Exit(1)
+		}
+	}
+	prevTime, prevTook := prevHdr.Timestamp, prevHdr.took()
+	days := 0.0
+	if !prevTime.IsZero() {
+		days = time.Since(prevTime).Hours() / 24
+	}
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if *timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), *timeout)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	go func() {
+		<-sig
+		fmt.Fprintln(os.Stderr, "\nInterrupted – finalising…")
+		cancel()
+	}()
+	machine := *summaryOut || *jsonOut || *jsonAll || *ndjson || *csvPath == "-" || *compact || *lineFmt != "" || *rawPath != "" || *rmScript == "-"
+	opts := scanner.DefaultOptions()
+	opts.Excludes = excludes
+	opts.Includes = includes
+	opts.SlowThreshold = *slow
+	opts.SlowDirThreshold = *slowDir
+	opts.Workers = *workers
+	opts.OneFileSystem = oneFS
+	opts.IncludeMounts = includeMounts
+	opts.ApparentSize = *apparent
+	opts.CountLinks = *countLinks
+	opts.FollowSymlinks = *followLinks
+	opts.FollowExternal = *followExt
+	opts.MaxDepth = *maxDepth
+	opts.Sniff = *sniff
+	opts.SniffMinSize = sniffMin
+	opts.UseGitignore = *useGitignore
+	opts.NoHidden = *noHidden
+	opts.NoHiddenFiles = *noHiddenFiles
+	opts.FindDupes = *findDupes
+	opts.TopFiles = *topFiles
+	opts.MinFileSize = minFileBytes
+	opts.DupeMinSize = dupeMin
+	opts.PeekArchives = *peekArchives
+	opts.TrackChurn = *trackChurn
+	opts.ExcludeCategories = dropCats
+	opts.Since = since
+	opts.Until = until
+	opts.PeekMinSize = peekMin
+	opts.CountDirOverhead = *dirOverhead
+	opts.TrackLogical = *showCompression
+	opts.Retries = *retries
+	opts.RetryDelay = *retryDelay
+	savedSettings = settingsOf(opts)
+	if *incremental && !*forceFull && len(localPrev) > 0 {
+		if localHdr.Settings == nil || *localHdr.Settings != savedSettings {
+			fmt.Fprintln(os.Stderr, "note: the previous scan counted files with other options; reading every directory")
+		} else {
+			opts.Previous = localPrev
+		}
+	}
+	if loaded == nil {
+		if fi, err := os.Stat(root); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		} else if fi.IsDir() {
+			d, err := os.Open(root)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			d.Close()
+		} else {
+			f, err := scanner.StatFile(root, opts)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			if *rmScript != "" {
+				fmt.Fprintf(os.Stderr, "--emit-rm needs a directory; %s is a file\n", root)
+				os.Exit(2)
+			}
+			// The machine formats describe the file as a directory
+			// holding only itself, so that their output keeps its shape.
+			rec := fileRecord(f)
+			dirs := []*scanner.FolderSize{rec}
+			var sum *Summary
+			if *summaryOut {
+				sum = summarize(map[string]*scanner.FolderSize{root: rec}, root, 0, false)
+			}
+			if *csvPath != "" {
+				if err := exportCSV(*csvPath, dirs); err != nil {
+					fmt.Fprintln(os.Stderr, "csv:", err)
+					os.Exit(1)
+				}
+			}
+			switch {
+			case *rawPath != "":
+				fmt.Fprintln(stdout, f.Size)
+			case *compact:
+				fmt.Fprintf(stdout, "%s\t1\t%s\n", formatSize(f.Size), f.Path)
+			case *ndjson:
+				enc := json.NewEncoder(stdout)
+				enc.Encode(zoned(rec))
+				if sum != nil {
+					sum.Type = "summary"
+					enc.Encode(sum)
+				}
+			case (*jsonOut || *jsonAll) && sum != nil:
+				writeJSONSummary(stdout, dirs, sum)
+			case *jsonOut || *jsonAll:
+				writeJSON(stdout, dirs)
+			case sum != nil:
+				enc := json.NewEncoder(stdout)
+				enc.SetIndent("", "  ")
+				enc.Encode(sum)
+			case format != nil:
+				if err := format.write(stdout, dirs, f.Size); err != nil {
+					fmt.Fprintln(os.Stderr, "--format:", err)
+					os.Exit(1)
+				}
+			}
+			if machine {
+				return
+			}
+			fmt.Fprintf(stdout, "%s is a file, not a directory:\n   %10s  %s  %s%s%s\n", root, formatSize(f.Size), formatDate(f.Mtime),
+				color(getColorForCategory(f.Category)), f.Category, color(ColorReset))
+			return
+		}
+	}
+	if *benchPath != "" {
+		if err := runBenchmark(ctx, root, opts); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if plan {
+		if err := printPlan(root, opts); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if *watchEvery > 0 {
+		var reload func() (scanner.ExcludeRules, error)
+		if len(excludeFrom) > 0 {
+			reload = loadExcludes
+		}
+		watch(ctx, root, opts, *watchEvery, *topN, db, reload)
+		return
+	}
+	if *progressMode == "" {
+		*progressMode = "text"
+		if machine || loaded != nil {
+			*progressMode = "none"
+		}
+	}
+	var prog chan scanner.Progress
+	done := make(chan struct{})
+	if *progressMode != "none" {
+		prog = make(chan scanner.Progress, 16)
+		opts.Progress = prog
+		var expect int64
+		d, err := scanner.DiskUsage(root)
+		if err == nil && scanner.IsMountRoot(root) {
+			expect = d.Used
+		}
+		if *estimate && loaded == nil {
+			if *progressMode == "text" {
+				fmt.Fprint(os.Stderr, "Estimating size…")
+			}
+			// The filesystem cannot hold more than it has in use, which
+			// reins in a sample that landed in an unusually full branch.
+			if est, eerr := scanner.Estimate(ctx, root, opts, estimateBudget); eerr == nil && est > 0 {
+				expect = est
+				if err == nil && d.Used > 0 {
+					expect = min(est, d.Used)
+				}
+			}
+			if *progressMode == "text" {
+				fmt.Fprint(os.Stderr, "\r\033[K")
+			}
+		}
+		go progressReporter(ctx, prog, done, *progressMode == "json", expect)
+	}
+	stopProgress := func() {
+		if prog == nil {
+			return
+		}
+		close(prog)
+		<-done
+		if *progressMode == "text" {
+			fmt.Fprintln(os.Stderr)
+		}
+	}
+	if *ndjson {
+		enc := json.NewEncoder(stdout)
+		sum := newSummary(root)
+		// Records stream out as they are read, so --max-results can only
+		// keep the first ones; the summary still covers the whole scan.
+		written := 0
+		opts.Emit = func(fs *scanner.FolderSize) {
+			sum.count(fs)
+			sum.Bytes += fs.Total
+			sum.Files += fs.FileCount
+			if *maxResults > 0 && written >= *maxResults {
+				return
+			}
+			written++
+			if err := enc.Encode(zoned(fs)); err != nil {
+				cancel()
+			}
+		}
+		start := time.Now()
+		_, err := scanner.Scan(ctx, root, opts)
+		stopProgress()
+		timedOut(ctx, *timeout)
+		if err != nil && ctx.Err() == nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if ctx.Err() != nil {
+			code = exitPartial
+		}
+		if *summaryOut {
+			sum.Type, sum.ScanSeconds, sum.Partial = "summary", time.Since(start).Seconds(), ctx.Err() != nil
+			enc.Encode(sum)
+		}
+		return
+	}
+	// The disk shares and inode warnings of the report need the disk even
+	// when --quiet leaves out the banner; a report from --from-ndjson may
+	// come from another machine and goes without.
+	if loaded == nil {
+		if d, err := scanner.DiskUsage(root); err == nil && d.Total > 0 {
+			disk = d
+		}
+	}
+	if !machine && !*quiet && loaded != nil {
+		fmt.Fprintf(stdout, "Report for '%s' from %s\n\n", root, *fromNDJSON)
+	} else if !machine && !*quiet {
+		fmt.Fprintf(stdout, "Scanning '%s'…\n", root)
+		if d := disk; d.Total > 0 {
+			fmt.Fprintf(stdout, "Disk: %s total, %s used (%.1f%%), %s free\n", formatSize(d.Total), formatSize(d.Used),
+				float64(d.Used)*100/float64(d.Total), formatSize(d.Free))
+			if pct := inodePct(d); pct >= 0 {
+				fmt.Fprintf(stdout, "Inodes: %s total, %s used (%.1f%%), %s free\n", formatCount(d.Inodes), formatCount(d.Inodes-d.InodesFree),
+					pct, formatCount(d.InodesFree))
+			}
+		}
+		switch {
+		case !since.IsZero() && !until.IsZero():
+			fmt.Fprintf(stdout, "Counting only files modified between %s and %s\n", since.Format("2006-01-02 15:04"), until.Format("2006-01-02 15:04"))
+		case !since.IsZero():
+			fmt.Fprintf(stdout, "Counting only files modified since %s\n", since.Format("2006-01-02 15:04"))
+		case !until.IsZero():
+			fmt.Fprintf(stdout, "Counting only files modified before %s\n", until.Format("2006-01-02 15:04"))
+		}
+		if len(pathList) > 0 {
+			src := *pathsFrom
+			if src == "-" {
+				src = "standard input"
+			}
+			fmt.Fprintf(stdout, "Limited to %s directories from %s\n", formatCount(int64(len(pathList))), src)
+		}
+		fmt.Fprintln(stdout)
+	}
+	var m map[string]*scanner.FolderSize
+	var stats scanner.Stats
+	scanStart := time.Now()
+	// With --max-depth the scanner already folds deeper directories away,
+	// so only --no-aggregate needs the records streamed.
+	var stream *streamCollector
+	if *streaming && selfOnly {
+		keep := *topN
+		if *maxResults > keep {
+			keep = *maxResults
+		}
+		stream = newStreamCollector(root, keep)
+		opts.Emit = stream.add
+	}
+	if loaded != nil {
+		m = loaded
+	} else {
+		m, stats, err = scanner.ScanStats(ctx, root, opts)
+	}
+	if stream != nil {
+		m = stream.result()
+	}
+	scanTook := time.Since(scanStart)
+	stopProgress()
+	timedOut(ctx, *timeout)
+	if err != nil && ctx.Err() == nil {
+		fmt.Fprintln(os.Stderr, err)
+		// Whatever was read before the failure is still worth keeping.
+		if m != nil {
+			scanner.AggregateTotals(m)
+			dropOutside(m, root)
+			saveHistory(db, m, scanTook, true)
+		}
+		os.Exit(1)
+	}
+	if stream == nil {
+		scanner.AggregateTotals(m)
+		dropOutside(m, root)
+	}
+	partial := ctx.Err() != nil
+	// A crash while reporting must not cost the scan: save it, then let
+	// the panic carry on without the deferred exit swallowing it.
+	defer func() {
+		if r := recover(); r != nil {
+			saveHistory(db, m, scanTook, true)
+			code = 0
+			panic(r)
+		}
+	}()
+	code = exitStatus(ctx, m, root, alertBytes)
+	if stream != nil && stream.failed && (code == 0 || code == exitPartial) {
+		code = exitScanErrors
+	}
+	catHits := categoryOverruns(m, catLimits)
+	if len(catHits) > 0 {
+		reportCategoryOverruns(catHits)
+		code = exitAlert
+	}
+	if (growthPct > 0 || growthBytes > 0) && prevMap != nil && ctx.Err() == nil && !machine && !*interactive {
+		printGrowthAlerts(growthAlerts(prevMap, m, root, growthPct, growthBytes), *topN, growthPct, growthBytes)
+	}
+	cutoff := time.Now().Add(-olderThan)
+	// listed holds for every directory the report may show, whether or
+	// not it reaches --min-size.
+	listed := func(fs *scanner.FolderSize) bool {
+		if olderThan > 0 && (fs.Newest.IsZero() || fs.Newest.After(cutoff)) {
+			return false
+		}
+		if *depth >= 0 && relDepth(root, fs.Path) != *depth {
+			return false
+		}
+		return shownSize(fs) <= maxBytes && fs.FileCount >= *minFiles && (shownSize(fs) > 0 || *showEmpty)
+	}
+	var fat []*scanner.FolderSize
+	for _, fs := range m {
+		if listed(fs) && (shownSize(fs) >= minBytes || *depth >= 0) {
 			fat = append(fat, fs)
 		}
-		sort.Slice(fat, func(i, j int) bool { return fat[i].Total > fat[j].Total })
-		if len(fat) > *topN {
-			fat = fat[:*topN]
+	}
+	sort.Slice(fat, func(i, j int) bool { return less(fat[i], fat[j]) })
+	if len(fat) == 0 && *fallbackTop && !*noFallback {
+		for _, fs := range m {
+			if listed(fs) {
+				fat = append(fat, fs)
+			}
+		}
+		sort.Slice(fat, func(i, j int) bool { return less(fat[i], fat[j]) })
+		if len(fat) > *offset+*topN {
+			fat = fat[:*offset+*topN]
 		}
-		fmt.Printf("Top %d directories (no one reached %s):\n", len(fat), formatSize(minBytes))
-	} else if len(fat) > *topN {
+		if !machine && !*tree && !*interactive && !*byType && *perParent == 0 && len(fat) > *offset {
+			fmt.Fprintf(stdout, "Top %d directories (no one reached %s):\n", len(fat)-*offset, formatSize(minBytes))
+		}
+	}
+	// --offset pages through the sorted list, skipping that many
+	// directories in the report and the machine outputs alike.
+	qualified := len(fat)
+	if *offset > 0 {
+		fat = fat[min(*offset, len(fat)):]
+	}
+	// results is what the machine-readable outputs get: everything that
+	// qualified unless --max-results says otherwise. --top only trims the
+	// human-readable report.
+	results := fat
+	if *maxResults > 0 && len(results) > *maxResults {
+		results = results[:*maxResults]
+	}
+	if len(fat) > *topN {
 		fat = fat[:*topN]
 	}
-	for _, fs := range fat {
-		printFat(fs, m, prevMap)
+	if *offset > 0 && len(fat) > 0 && !machine && !*tree && !*interactive && !*byType && *perParent == 0 {
+		fmt.Fprintf(stdout, "Directories %d–%d of %d:\n", *offset+1, *offset+len(fat), qualified)
 	}
-	if !prevTime.IsZero() {
-		fmt.Printf("\nTime since previous scan: %s\n", time.Since(prevTime).Round(time.Second))
+	if *rawPath != "" {
+		saveHistory(db, m, scanTook, partial)
+		saveCurrent(snapFile, m, scanTook, partial)
+		fs := rawLookup(m, root, *rawPath)
+		if fs == nil {
+			fmt.Fprintf(os.Stderr, "--raw: %s was not scanned\n", *rawPath)
+			os.Exit(1)
+		}
+		fmt.Fprintln(stdout, fs.Total)
+		return
+	}
+	if *csvPath != "" {
+		if err := exportCSV(*csvPath, results); err != nil {
+			fmt.Fprintln(os.Stderr, "csv:", err)
+		}
+	}
+	if *rmScript != "" {
+		if err := exportRmScript(*rmScript, m, root); err != nil {
+			fmt.Fprintln(os.Stderr, "emit-rm:", err)
+		}
+	}
+	if *promPath != "" {
+		if err := exportPrometheus(*promPath, results, len(m), scanTook); err != nil {
+			fmt.Fprintln(os.Stderr, "prometheus:", err)
+		}
+	}
+	var sum *Summary
+	if *summaryOut {
+		if stream != nil {
+			sum = stream.counts
+			sum.Bytes, sum.Files = stream.total.Total, stream.total.FileCount
+			sum.ScanSeconds, sum.Partial = scanTook.Seconds(), partial
+		} else {
+			sum = summarize(m, root, scanTook, partial)
+		}
+	}
+	if *jsonOut || *jsonAll {
+		out := results
+		if *jsonAll {
+			out = make([]*scanner.FolderSize, 0, len(m))
+			for _, fs := range m {
+				out = append(out, fs)
+			}
+			sort.Slice(out, func(i, j int) bool { return less(out[i], out[j]) })
+		}
+		write := writeJSON
+		if *summaryOut {
+			write = func(w io.Writer, dirs []*scanner.FolderSize) error {
+				return writeJSONSummary(w, dirs, sum)
+			}
+		}
+		if err := write(stdout, out); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	} else if *summaryOut {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(sum)
+	}
+	if *compact {
+		for _, fs := range results {
+			fmt.Fprintf(stdout, "%s\t%d\t%s\n", formatSize(shownSize(fs)), fs.FileCount, fs.Path)
+		}
+	}
+	if format != nil {
+		var rootTotal int64
+		if stream != nil {
+			rootTotal = stream.total.Total
+		} else if fs := m[root]; fs != nil {
+			rootTotal = fs.Total
+		}
+		if err := format.write(stdout, results, rootTotal); err != nil {
+			fmt.Fprintln(os.Stderr, "--format:", err)
+			os.Exit(1)
+		}
+	}
+	if machine {
+		saveHistory(db, m, scanTook, partial)
+		saveCurrent(snapFile, m, scanTook, partial)
+		return
+	}
+	if *interactive {
+		if err := browse(filepath.Clean(root), m, *sortKey, *reverse); err != nil {
+			fmt.Fprintln(os.Stderr, "interactive:", err)
+		}
+		saveHistory(db, m, scanTook, partial)
+		saveCurrent(snapFile, m, scanTook, partial)
+		return
+	}
+	switch {
+	case *byType:
+		printByType(m, *topN)
+	case *tree:
+		printTree(filepath.Clean(root), m, minBytes, less)
+	case *perParent > 0:
+		printPerParent(m, *perParent, minBytes, less)
+	default:
+		for _, fs := range fat {
+			printFat(fs, m, prevMap, days)
+		}
+	}
+	if !*byType && (len(fat) > 0 || !*quiet) {
+		if stream != nil {
+			printTypeSummary(stream.summary(), 5)
+		} else {
+			printTypeSummary(m, 5)
+		}
+	}
+	if *topFiles > 0 {
+		printTopFiles(stats.TopFiles)
+	}
+	if *ageHist {
+		printAgeHistogram(stats.AgeBytes)
+	}
+	if suggestCleanup {
+		printCleanup(m, *topN)
+	}
+	printCategoryAlerts(catHits, *topN)
+	if stream != nil {
+		printInodes(nil, root, *topN, *showInodes)
+	} else {
+		printInodes(m, root, *topN, *showInodes)
+	}
+	if *peekArchives {
+		printArchives(stats.Archives, *topN)
+	}
+	if *findDupes && ctx.Err() == nil {
+		printDupes(stats.Dupes, *topN)
+	}
+	if stats.Denied > 0 {
+		printDenied(m, prevMap, stats.Denied)
+	}
+	if stats.Reused > 0 && !*quiet {
+		fmt.Fprintf(stdout, "\nIncremental: %s unchanged directories taken from the previous scan (--force-full reads them all)\n", formatCount(stats.Reused))
+	}
+	if stats.Sniffed > 0 && !*quiet {
+		fmt.Fprintf(stdout, "\nContent sniffing reclassified %s files\n", formatCount(stats.Sniffed))
+	}
+	if stats.LinkedBytes > 0 && stats.LinkedBytes*100 >= stats.BytesScanned && !*quiet {
+		fmt.Fprintf(stdout, "\nHard links: %s counted once (use --count-links to include every link)\n", formatSize(stats.LinkedBytes))
+	}
+	if days > 0 {
+		printGrowthRates(m, prevMap, root, days)
+	}
+	if *showRemoved && prevMap != nil && ctx.Err() == nil {
+		printRemoved(m, prevMap, root, minBytes, *topN)
+	}
+	if !prevTime.IsZero() && !*quiet {
+		fmt.Fprintf(stdout, "\nTime since previous scan: %s\n", time.Since(prevTime).Round(time.Second))
+		if prevTook > 0 {
+			fmt.Fprintf(stdout, "Previous scan took %s, this scan took %s\n", prevTook.Round(10*time.Millisecond), scanTook.Round(10*time.Millisecond))
+		}
 	}
-	saveCurrent(dbPath(), m)
+	saveHistory(db, m, scanTook, partial)
+	saveCurrent(snapFile, m, scanTook, partial)
 }
 
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"find-large-dirs/scanner"
+)
+
+// TestMain lets the tests run the command itself: the test binary acts
+// as find-large-dirs when FLD_RUN_MAIN is set.
+func TestMain(m *testing.M) {
+	if os.Getenv("FLD_RUN_MAIN") != "" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// run runs the command with args and returns its standard output and
+// exit status.
+func run(t *testing.T, args ...string) (string, int) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), "FLD_RUN_MAIN=1", "NO_COLOR=1")
+	out, err := cmd.Output()
+	var ee *exec.ExitError
+	if errors.As(err, &ee) {
+		return string(out), ee.ExitCode()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out), 0
+}
+
+// fileRoot creates a file of n bytes to give the command as its root.
+func fileRoot(t *testing.T, n int) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), "big.bin")
+	if err := os.WriteFile(p, make([]byte, n), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestFileRootFormats(t *testing.T) {
+	p := fileRoot(t, 3000)
+	out, code := run(t, "--no-db", "--apparent-size", "--csv", "-", p)
+	rows, err := csv.NewReader(strings.NewReader(out)).ReadAll()
+	if code != 0 || err != nil || len(rows) != 2 || rows[0][0] != "path" || rows[1][0] != p || rows[1][1] != "3000" {
+		t.Errorf("--csv - on a file printed (status %d, %v):\n%s", code, err, out)
+	}
+	out, code = run(t, "--no-db", "--apparent-size", "--json", p)
+	if code != 0 || !strings.HasPrefix(out, "[") || !strings.Contains(out, `"total_bytes": 3000`) {
+		t.Errorf("--json on a file printed (status %d):\n%s", code, out)
+	}
+	if _, code = run(t, "--no-db", "--emit-rm", "-", p); code != 2 {
+		t.Errorf("--emit-rm on a file exited with %d, want 2", code)
+	}
+}
+
+func TestRawFileRoot(t *testing.T) {
+	p := fileRoot(t, 3000)
+	out, code := run(t, "--no-db", "--apparent-size", "--raw", p)
+	if code != 0 || out != "3000\n" {
+		t.Errorf("--raw on a file printed %q with status %d, want \"3000\\n\"", out, code)
+	}
+}
+
+func TestFormatFileRoot(t *testing.T) {
+	p := fileRoot(t, 3000)
+	out, code := run(t, "--no-db", "--apparent-size", "--format", "{{base .Path}} {{.Total}} {{.FileCount}} {{pct .Total}}", p)
+	if want := "big.bin 3000 1 100.0%\n"; code != 0 || out != want {
+		t.Errorf("--format on a file printed %q with status %d, want %q", out, code, want)
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	mt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	dirs := []*scanner.FolderSize{{
+		Path: `/data/a,b "c"`, Total: 3000, FileCount: 2, SubdirCount: 1, Oldest: mt, Newest: mt,
+		FileTypes: map[string]int64{"Video": 2000, "Other": 1000},
+	}}
+	var buf bytes.Buffer
+	if err := writeCSV(&buf, dirs); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"/data/a,b ""c""",3000,`) {
+		t.Errorf("path is not quoted for CSV:\n%s", buf.String())
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("%d rows, want a header and one directory", len(rows))
+	}
+	cats := scanner.KnownCategories()
+	head := append([]string{"path", "total_bytes", "file_count", "subdir_count", "oldest_mtime", "newest_mtime"}, cats...)
+	if strings.Join(rows[0], "|") != strings.Join(head, "|") {
+		t.Errorf("header %q, want %q", rows[0], head)
+	}
+	row := map[string]string{}
+	for i, h := range rows[0] {
+		row[h] = rows[1][i]
+	}
+	for col, want := range map[string]string{
+		"path": `/data/a,b "c"`, "total_bytes": "3000", "file_count": "2", "subdir_count": "1",
+		"oldest_mtime": formatTime(mt), "newest_mtime": formatTime(mt), "Video": "2000", "Other": "1000", "Image": "0",
+	} {
+		if row[col] != want {
+			t.Errorf("%s = %q, want %q", col, row[col], want)
+		}
+	}
+}
+
+func TestFormatSizeUnits(t *testing.T) {
+	defer func(u string) { sizeUnits = u }(sizeUnits)
+	for _, c := range []struct {
+		units string
+		n     int64
+		want  string
+	}{
+		{"si", 1500000, "1.50 MB"},
+		{"iec", 1500000, "1.43 MiB"},
+		{"legacy", 1500000, "1.43 MB"},
+		{"si", 999, "999 B"},
+		{"si", 1500, "1.5 kB"},
+		{"iec", 1536, "1.5 KiB"},
+		{"iec", 5 << 40, "5.00 TiB"},
+	} {
+		sizeUnits = c.units
+		if got := formatSize(c.n); got != c.want {
+			t.Errorf("%s: formatSize(%d) = %q, want %q", c.units, c.n, got, c.want)
+		}
+	}
+}
+
+func TestHistoryRoundTrip(t *testing.T) {
+	mt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	m := map[string]*scanner.FolderSize{
+		"/data":   {Path: "/data", Size: 10, Total: 3010, FileCount: 1, SubdirCount: 1, FileTypes: map[string]int64{"Log": 10}},
+		"/data/v": {Path: "/data/v", Size: 3000, Total: 3000, FileCount: 2, Oldest: mt, Newest: mt, FileTypes: map[string]int64{"Video": 3000}},
+	}
+	for _, name := range []string{"history.json", "history.json.gz"} {
+		p := filepath.Join(t.TempDir(), name)
+		saveCurrent(p, m, 90*time.Second, false)
+		raw, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if gz := bytes.HasPrefix(raw, []byte{0x1f, 0x8b}); gz != strings.HasSuffix(name, ".gz") {
+			t.Errorf("%s: gzip-compressed is %v", name, gz)
+		}
+		got, hdr := loadPrev(p)
+		if hdr.Version != dbVersion || hdr.Timestamp.IsZero() || hdr.took() != 90*time.Second || hdr.Partial {
+			t.Errorf("%s: header %+v", name, hdr)
+		}
+		if len(got) != len(m) {
+			t.Fatalf("%s: %d directories back, want %d", name, len(got), len(m))
+		}
+		for path, want := range m {
+			g := got[path]
+			if g == nil || g.Total != want.Total || g.FileCount != want.FileCount || !g.Newest.Equal(want.Newest) ||
+				!reflect.DeepEqual(g.FileTypes, want.FileTypes) {
+				t.Errorf("%s: %s came back as %+v, want %+v", name, path, g, want)
+			}
+		}
+	}
+}
+
+// TestLoadPrevPlainJSON reads history files written before compression,
+// and those of version 1, which only held paths and totals.
+func TestLoadPrevPlainJSON(t *testing.T) {
+	dir := t.TempDir()
+	for name, body := range map[string]string{
+		"v1.json": `{"timestamp": "2023-05-01T10:00:00Z", "entries": [{"path": "/data", "size": 3010}]}`,
+		"v2.json": `{"version": 2, "timestamp": "2023-05-01T10:00:00Z", "dirs": [{"path": "/data", "total_bytes": 3010}]}`,
+	} {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		m, hdr := loadPrev(p)
+		if fs := m["/data"]; fs == nil || fs.Total != 3010 {
+			t.Errorf("%s: /data = %+v, want a total of 3010", name, fs)
+		}
+		if want := time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC); !hdr.Timestamp.Equal(want) {
+			t.Errorf("%s: timestamp %v, want %v", name, hdr.Timestamp, want)
+		}
+	}
+}
+
+func TestExpandPath(t *testing.T) {
+	home, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	work := filepath.Join(home, "work", "src")
+	if err := os.MkdirAll(work, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(work, filepath.Join(home, "link")); err != nil {
+		t.Skipf("cannot create symlinks here: %v", err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(work); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	sep := string(filepath.Separator)
+	for _, c := range []struct{ in, want string }{
+		{"~", home},
+		{"~" + sep, home},
+		{"~/work", filepath.Join(home, "work")},
+		{"~/work/src/", work},
+		{".", work},
+		{"./", work},
+		{"..", filepath.Join(home, "work")},
+		{"../src/../src", work},
+		{work + sep, work},
+		{filepath.Join(home, "link"), work},
+		{"~/link/", work},
+		{"~/missing/dir/", filepath.Join(home, "missing", "dir")},
+		{"~user", filepath.Join(work, "~user")},
+	} {
+		if got := expandPath(c.in); got != c.want {
+			t.Errorf("expandPath(%q) = %q, want %q", c.in, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"text/template"
+
+	"find-large-dirs/scanner"
+)
+
+// lineFormat is a --format template, run once per reported directory with
+// the directory's FolderSize as dot. Besides the fields it can use:
+//
+//	size N        N bytes in the units of the report, see --units
+//	pct N         N as a percentage of the scan root's total
+//	pct N OF      N as a percentage of OF
+//	base PATH     the last element of PATH
+//	count N       N with thousands separators
+//	date T        T in the --date-format layout
+//
+// For example '{{size .Total}} {{.Path}}' or
+// '{{pct .Total}} {{base .Path}} ({{count .FileCount}} files)'.
+type lineFormat struct {
+	t         *template.Template
+	rootTotal int64
+}
+
+// parseFormat compiles a --format template and tries it on an empty
+// directory, so that a misspelt field fails before the scan rather than
+// after it.
+func parseFormat(s string) (*lineFormat, error) {
+	f := &lineFormat{}
+	t, err := template.New("format").Funcs(template.FuncMap{
+		"size":  formatSize,
+		"pct":   f.pct,
+		"base":  filepath.Base,
+		"count": formatCount,
+		"date":  formatDate,
+	}).Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	f.t = t
+	if err := t.Execute(io.Discard, &scanner.FolderSize{}); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *lineFormat) pct(n int64, of ...int64) (string, error) {
+	whole := f.rootTotal
+	switch len(of) {
+	case 0:
+	case 1:
+		whole = of[0]
+	default:
+		return "", fmt.Errorf("pct takes one or two numbers, got %d", 1+len(of))
+	}
+	if whole == 0 {
+		return "0.0%", nil
+	}
+	return fmt.Sprintf("%.1f%%", float64(n)*100/float64(whole)), nil
+}
+
+// write runs the template for each of dirs, one line each. rootTotal is
+// what pct compares with by default.
+func (f *lineFormat) write(w io.Writer, dirs []*scanner.FolderSize, rootTotal int64) error {
+	f.rootTotal = rootTotal
+	for _, fs := range dirs {
+		if err := f.t.Execute(w, zoned(fs)); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, "\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"find-large-dirs/scanner"
+)
+
+// parsePercent reads a --growth-alert value such as "50" or "50%".
+func parsePercent(s string) (float64, error) {
+	v, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(s), "%"), 64)
+	if err != nil || v <= 0 {
+		return 0, fmt.Errorf("want a positive percentage, got %q", s)
+	}
+	return v, nil
+}
+
+// growthAlerts returns the directories below root, not root itself, that
+// grew since the previous scan by at least pct percent or by at least size
+// bytes, a zero threshold being off, largest growth first. Directories
+// that are new have no percentage and only count against size. The root
+// would fire whenever anything below it does.
+func growthAlerts(prev, all map[string]*scanner.FolderSize, root string, pct float64, size int64) []dirChange {
+	var out []dirChange
+	for _, c := range diffSnapshots(prev, all) {
+		if c.Status != "grown" && c.Status != "added" || relDepth(root, c.Path) <= 0 {
+			continue
+		}
+		grew := c.New - c.Old
+		if size > 0 && grew >= size || pct > 0 && c.Old > 0 && float64(grew)*100/float64(c.Old) >= pct {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// printGrowthAlerts puts the directories found by growthAlerts for the
+// thresholds pct and size at the top of the report.
+func printGrowthAlerts(alerts []dirChange, top int, pct float64, size int64) {
+	if len(alerts) == 0 {
+		return
+	}
+	var over []string
+	if pct > 0 {
+		over = append(over, fmt.Sprintf("%g%%", pct))
+	}
+	if size > 0 {
+		over = append(over, formatSize(size))
+	}
+	fmt.Fprintf(stdout, "%sGrowth alerts (over %s since the previous scan):%s\n", color(Bold), strings.Join(over, " or "), color(ColorReset))
+	for i, c := range alerts {
+		if i >= top {
+			fmt.Fprintf(stdout, "   … and %s more\n", formatCount(int64(len(alerts)-top)))
+			break
+		}
+		what := "new"
+		if c.Old > 0 {
+			what = fmt.Sprintf("grew %.0f%%", float64(c.New-c.Old)*100/float64(c.Old))
+		}
+		fmt.Fprintf(stdout, "   %s⚠ %s%s  %12s  %s → %s  %s\n", color(ColorRed), padRight(what, 10), color(ColorReset),
+			signedSize(c.New-c.Old), formatSize(c.Old), formatSize(c.New), c.Path)
+	}
+	fmt.Fprintln(stdout)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"find-large-dirs/scanner"
+)
+
+// inodeWarnPct is the inode usage at which the report warns and lists the
+// directories holding the most of them.
+const inodeWarnPct = 90
+
+// inodePct returns the share of d's inodes in use, or -1 when the
+// filesystem does not report them.
+func inodePct(d scanner.Disk) float64 {
+	if d.Inodes <= 0 {
+		return -1
+	}
+	return float64(d.Inodes-d.InodesFree) * 100 / float64(d.Inodes)
+}
+
+// inodes is the number of files and directories in the subtree of fs,
+// itself included, near enough to the inodes it takes.
+func inodes(fs *scanner.FolderSize) int64 {
+	return fs.FileCount + fs.SubdirCount + 1
+}
+
+// inodeHogs returns the n directories below root, not root itself, holding
+// the most inodes. A directory is passed over in favour of a child holding
+// more than dominantPct percent of its inodes, which tells the story better.
+func inodeHogs(all map[string]*scanner.FolderSize, root string, n int) []*scanner.FolderSize {
+	biggest := map[string]int64{}
+	for p, fs := range all {
+		if par := filepath.Dir(p); par != p && !fs.Skipped {
+			biggest[par] = max(biggest[par], inodes(fs))
+		}
+	}
+	var out []*scanner.FolderSize
+	for p, fs := range all {
+		if fs.Skipped || relDepth(root, p) <= 0 || float64(biggest[p])*100 > dominantPct*float64(inodes(fs)) {
+			continue
+		}
+		out = append(out, fs)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if a, b := inodes(out[i]), inodes(out[j]); a != b {
+			return a > b
+		}
+		return out[i].Path < out[j].Path
+	})
+	if len(out) > n {
+		out = out[:n]
+	}
+	return out
+}
+
+// printInodes warns when the filesystem is running out of inodes, which
+// stops new files being created however much space is left, and lists
+// the directories holding the most of them. all may be nil when the scan
+// kept too little to tell. always lists them at any usage.
+func printInodes(all map[string]*scanner.FolderSize, root string, n int, always bool) {
+	pct := inodePct(disk)
+	if pct < 0 || pct < inodeWarnPct && !always {
+		return
+	}
+	if pct >= inodeWarnPct {
+		bytesPct := float64(disk.Used) * 100 / float64(disk.Total)
+		fmt.Fprintf(stdout, "\n%s⚠ %.1f%% of inodes in use%s with %.1f%% of the space used: ", color(ColorRed), pct, color(ColorReset), bytesPct)
+		fmt.Fprintf(stdout, "only %s more files can be created\n", formatCount(disk.InodesFree))
+	}
+	if all == nil {
+		return
+	}
+	hogs := inodeHogs(all, root, n)
+	if len(hogs) == 0 {
+		return
+	}
+	fmt.Fprintf(stdout, "\n%sMost files and directories (inodes):%s\n", color(Bold), color(ColorReset))
+	used := disk.Inodes - disk.InodesFree
+	for _, fs := range hogs {
+		fmt.Fprintf(stdout, "   %12s  %5.1f%% of used  %10s  %s\n", formatCount(inodes(fs)), float64(inodes(fs))*100/float64(used),
+			formatSize(fs.Total), fs.Path)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"find-large-dirs/scanner"
+)
+
+// loadNDJSON reads the directory records written by --ndjson, keyed by
+// path, together with the path of the first record, which is the root of
+// that scan. The records must be the raw ones, before AggregateTotals, so
+// that rolling them up again counts everything once.
+func loadNDJSON(p string) (map[string]*scanner.FolderSize, string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, "", err
+	}
+	defer f.Close()
+	m := map[string]*scanner.FolderSize{}
+	var first string
+	dec := json.NewDecoder(f)
+	for n := 1; ; n++ {
+		var raw json.RawMessage
+		err := dec.Decode(&raw)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("%s: record %d: %v", p, n, err)
+		}
+		// The --summary line is not a directory.
+		var tag struct{ Type string }
+		if json.Unmarshal(raw, &tag) == nil && tag.Type == "summary" {
+			continue
+		}
+		var fs scanner.FolderSize
+		if err := json.Unmarshal(raw, &fs); err != nil {
+			return nil, "", fmt.Errorf("%s: record %d: %v", p, n, err)
+		}
+		switch {
+		case fs.Path == "":
+			return nil, "", fmt.Errorf("%s: record %d has no path", p, n)
+		case m[fs.Path] != nil:
+			return nil, "", fmt.Errorf("%s: record %d: %s appears twice", p, n, fs.Path)
+		case fs.Total != fs.Size+fs.DirBytes:
+			return nil, "", fmt.Errorf("%s: record %d: %s is already rolled up (total differs from size); only --ndjson output can be read", p, n, fs.Path)
+		}
+		if fs.FileTypes == nil {
+			fs.FileTypes = map[string]int64{}
+		}
+		if first == "" {
+			first = fs.Path
+		}
+		m[fs.Path] = &fs
+	}
+	if first == "" {
+		return nil, "", fmt.Errorf("%s: no records", p)
+	}
+	return m, first, nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// readPathList reads the --paths-from list, one directory per line, from
+// src or from stdin when src is "-". Paths are expanded like the root;
+// duplicates and paths inside another listed one are dropped so nothing
+// is counted twice. Entries that are not directories are reported and
+// left out.
+func readPathList(src string) ([]string, error) {
+	var data []byte
+	var err error
+	if src == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(src)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		p := expandPath(line)
+		if fi, err := os.Stat(p); err != nil {
+			fmt.Fprintln(os.Stderr, "--paths-from:", err)
+			continue
+		} else if !fi.IsDir() {
+			fmt.Fprintf(os.Stderr, "--paths-from: %s is not a directory\n", line)
+			continue
+		}
+		paths = append(paths, p)
+	}
+	listed := map[string]bool{}
+	for _, p := range paths {
+		listed[p] = true
+	}
+	var out []string
+	for p := range listed {
+		inside := false
+		for dir, par := p, filepath.Dir(p); par != dir; dir, par = par, filepath.Dir(par) {
+			if listed[par] {
+				inside = true
+				break
+			}
+		}
+		if !inside {
+			out = append(out, p)
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// commonDir returns the deepest directory that contains all of paths.
+func commonDir(paths []string) string {
+	dir := paths[0]
+	for _, p := range paths[1:] {
+		for relDepth(dir, p) < 0 {
+			up := filepath.Dir(dir)
+			if up == dir {
+				break
+			}
+			dir = up
+		}
+	}
+	return dir
+}
+
+// globEscape quotes the glob metacharacters in p so it can be used as an
+// --include pattern matching exactly p. filepath.Match has no escapes on
+// Windows, where those characters are rare in names anyway.
+func globEscape(p string) string {
+	if runtime.GOOS == "windows" {
+		return p
+	}
+	var b strings.Builder
+	for _, r := range p {
+		if strings.ContainsRune(`*?[\`, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"find-large-dirs/scanner"
+)
+
+// promLabel escapes v for use as a Prometheus label value.
+var promLabel = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// writePrometheus writes dirs and the scan-wide gauges in the Prometheus
+// text format, as read by the node_exporter textfile collector.
+func writePrometheus(w io.Writer, dirs []*scanner.FolderSize, scanned int, took time.Duration) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "# HELP find_large_dirs_bytes Total size of the directory and everything below it.")
+	fmt.Fprintln(bw, "# TYPE find_large_dirs_bytes gauge")
+	for _, fs := range dirs {
+		fmt.Fprintf(bw, "find_large_dirs_bytes{path=\"%s\"} %d\n", promLabel.Replace(fs.Path), fs.Total)
+	}
+	fmt.Fprintln(bw, "# HELP find_large_dirs_files Number of files in the directory and everything below it.")
+	fmt.Fprintln(bw, "# TYPE find_large_dirs_files gauge")
+	for _, fs := range dirs {
+		fmt.Fprintf(bw, "find_large_dirs_files{path=\"%s\"} %d\n", promLabel.Replace(fs.Path), fs.FileCount)
+	}
+	fmt.Fprintln(bw, "# HELP find_large_dirs_scan_duration_seconds How long the last scan took.")
+	fmt.Fprintln(bw, "# TYPE find_large_dirs_scan_duration_seconds gauge")
+	fmt.Fprintf(bw, "find_large_dirs_scan_duration_seconds %g\n", took.Seconds())
+	fmt.Fprintln(bw, "# HELP find_large_dirs_dirs_scanned Number of directories the last scan recorded.")
+	fmt.Fprintln(bw, "# TYPE find_large_dirs_dirs_scanned gauge")
+	fmt.Fprintf(bw, "find_large_dirs_dirs_scanned %d\n", scanned)
+	return bw.Flush()
+}
+
+// exportPrometheus writes the metrics to a temporary file next to path and
+// renames it into place, so a collector never reads a half-written file.
+func exportPrometheus(path string, dirs []*scanner.FolderSize, scanned int, took time.Duration) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if err := writePrometheus(f, dirs, scanned, took); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(0o644); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,21 @@
+package scanner
+
+import "time"
+
+const day = 24 * time.Hour
+
+// AgeBuckets are the upper bounds of the Stats.AgeBytes buckets, measured
+// from the start of the scan to each file's mtime. The last bucket of
+// AgeBytes holds everything older than the last bound.
+var AgeBuckets = [...]time.Duration{7 * day, 30 * day, 182 * day, 365 * day}
+
+// ageBucket returns the AgeBytes index for a file modified at mt.
+func ageBucket(now, mt time.Time) int {
+	age := now.Sub(mt)
+	for i, b := range AgeBuckets {
+		if age < b {
+			return i
+		}
+	}
+	return len(AgeBuckets)
+}
@@ -0,0 +1,99 @@
+package scanner
+
+import (
+	"hash/maphash"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// aggItem is one directory of a level on its way into its parent.
+type aggItem struct {
+	fs     *FolderSize
+	par    string
+	parent *FolderSize
+}
+
+// AggregateTotals rolls every directory's Total, counts, mtime span and
+// type mix up into its ancestors, so that afterwards each record covers
+// everything below it. A missing parent is created.
+//
+// Levels are folded deepest first. Within a level the children are split
+// between workers by parent, so every parent is written by a single worker
+// and no locking is needed; the sums are the same whatever the order.
+func AggregateTotals(m map[string]*FolderSize) {
+	var levels [][]string
+	for p := range m {
+		d := strings.Count(p, string(os.PathSeparator))
+		for len(levels) <= d {
+			levels = append(levels, nil)
+		}
+		levels[d] = append(levels[d], p)
+	}
+	workers := runtime.GOMAXPROCS(0)
+	seed := maphash.MakeSeed()
+	for d := len(levels) - 1; d >= 0; d-- {
+		level := levels[d]
+		if len(level) == 0 {
+			continue
+		}
+		n := workers
+		if len(level) < 4096 {
+			n = 1
+		}
+		// shards[c][k] holds the children from chunk c whose parent is
+		// folded by worker k.
+		shards := make([][][]aggItem, n)
+		chunk := (len(level) + n - 1) / n
+		var wg sync.WaitGroup
+		for c := 0; c < n; c++ {
+			lo, hi := c*chunk, min((c+1)*chunk, len(level))
+			shards[c] = make([][]aggItem, n)
+			wg.Add(1)
+			go func(c int) {
+				defer wg.Done()
+				for _, p := range level[lo:hi] {
+					par := filepath.Dir(p)
+					if par == p {
+						continue
+					}
+					k := 0
+					if n > 1 {
+						k = int(maphash.String(seed, par) % uint64(n))
+					}
+					shards[c][k] = append(shards[c][k], aggItem{m[p], par, m[par]})
+				}
+			}(c)
+		}
+		wg.Wait()
+		for _, sh := range shards {
+			for _, items := range sh {
+				for i := range items {
+					it := &items[i]
+					if it.parent != nil {
+						continue
+					}
+					if it.parent = m[it.par]; it.parent == nil {
+						it.parent = &FolderSize{Path: it.par, FileTypes: map[string]int64{}}
+						m[it.par] = it.parent
+					}
+				}
+			}
+		}
+		for k := 0; k < n; k++ {
+			wg.Add(1)
+			go func(k int) {
+				defer wg.Done()
+				for _, sh := range shards {
+					for _, it := range sh[k] {
+						it.parent.Total += it.fs.Total
+						mergeStats(it.parent, it.fs)
+					}
+				}
+			}(k)
+		}
+		wg.Wait()
+	}
+}
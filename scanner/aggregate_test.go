@@ -0,0 +1,138 @@
+package scanner
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// synthTree builds records for a tree of fan[0] directories below root,
+// fan[1] below each of those and so on, as a scan leaves them before
+// AggregateTotals.
+func synthTree(root string, fan []int, seed int64) map[string]*FolderSize {
+	rng := rand.New(rand.NewSource(seed))
+	cats := []string{"Video", "Images", "Logs", "Code", "Other"}
+	base := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	m := map[string]*FolderSize{}
+	add := func(p string) {
+		fs := &FolderSize{Path: p, FileTypes: map[string]int64{}, TypeCounts: map[string]int64{}}
+		for i := rng.Intn(3); i > 0; i-- {
+			c, n := cats[rng.Intn(len(cats))], rng.Int63n(1<<20)
+			fs.Size += n
+			fs.FileCount++
+			fs.FileTypes[c] += n
+			fs.TypeCounts[c]++
+			mt := base.Add(time.Duration(rng.Int63n(int64(5 * 365 * 24 * time.Hour))))
+			if fs.Oldest.IsZero() || mt.Before(fs.Oldest) {
+				fs.Oldest = mt
+			}
+			if mt.After(fs.Newest) {
+				fs.Newest = mt
+			}
+		}
+		fs.Total = fs.Size
+		m[p] = fs
+	}
+	level := []string{root}
+	add(root)
+	for _, n := range fan {
+		var next []string
+		for _, par := range level {
+			m[par].SubdirCount = int64(n)
+			for i := 0; i < n; i++ {
+				p := filepath.Join(par, fmt.Sprintf("d%d", i))
+				add(p)
+				next = append(next, p)
+			}
+		}
+		level = next
+	}
+	return m
+}
+
+// foldSequential is the plain rollup AggregateTotals must agree with:
+// every record into its parent, deepest first, one at a time.
+func foldSequential(m map[string]*FolderSize) {
+	paths := make([]string, 0, len(m))
+	for p := range m {
+		paths = append(paths, p)
+	}
+	depth := func(p string) int { return strings.Count(p, string(os.PathSeparator)) }
+	sort.Slice(paths, func(i, j int) bool { return depth(paths[i]) > depth(paths[j]) })
+	for _, p := range paths {
+		par := filepath.Dir(p)
+		if par == p {
+			continue
+		}
+		parent := m[par]
+		if parent == nil {
+			parent = &FolderSize{Path: par, FileTypes: map[string]int64{}}
+			m[par] = parent
+		}
+		parent.Total += m[p].Total
+		mergeStats(parent, m[p])
+	}
+}
+
+func TestAggregateTotalsMatchesSequentialFold(t *testing.T) {
+	// Levels of 4096 directories or more are split between workers,
+	// which needs more than one of them.
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+	root := filepath.Join(string(os.PathSeparator), "data")
+	got := synthTree(root, []int{20, 30, 15}, 1)
+	want := synthTree(root, []int{20, 30, 15}, 1)
+	AggregateTotals(got)
+	foldSequential(want)
+
+	if len(got) != len(want) {
+		t.Fatalf("%d records, want %d", len(got), len(want))
+	}
+	for p, w := range want {
+		g := got[p]
+		if g == nil {
+			t.Fatalf("%s missing", p)
+		}
+		if g.Total != w.Total || g.FileCount != w.FileCount || g.SubdirCount != w.SubdirCount {
+			t.Errorf("%s: total %d, files %d, subdirs %d; want %d, %d, %d", p, g.Total, g.FileCount, g.SubdirCount, w.Total, w.FileCount, w.SubdirCount)
+		}
+		if !g.Oldest.Equal(w.Oldest) || !g.Newest.Equal(w.Newest) {
+			t.Errorf("%s: mtimes %v – %v, want %v – %v", p, g.Oldest, g.Newest, w.Oldest, w.Newest)
+		}
+		if !reflect.DeepEqual(g.FileTypes, w.FileTypes) {
+			t.Errorf("%s: types %v, want %v", p, g.FileTypes, w.FileTypes)
+		}
+		if len(g.TypeCounts)+len(w.TypeCounts) > 0 && !reflect.DeepEqual(g.TypeCounts, w.TypeCounts) {
+			t.Errorf("%s: type counts %v, want %v", p, g.TypeCounts, w.TypeCounts)
+		}
+	}
+}
+
+// BenchmarkAggregateTotals rolls up a million directories, a hundred
+// below each of the levels above them, one record at a time as before
+// and level by level as AggregateTotals does.
+func BenchmarkAggregateTotals(b *testing.B) {
+	root := filepath.Join(string(os.PathSeparator), "data")
+	for _, c := range []struct {
+		name string
+		fold func(map[string]*FolderSize)
+	}{
+		{"sequential", foldSequential},
+		{"parallel", AggregateTotals},
+	} {
+		b.Run(c.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				m := synthTree(root, []int{100, 100, 100}, int64(i))
+				b.StartTimer()
+				c.fold(m)
+			}
+		})
+	}
+}
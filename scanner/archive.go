@@ -0,0 +1,180 @@
+package scanner
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ArchiveEntry is what PeekArchives found inside one archive: the
+// uncompressed size, file count and type mix of its members, as if it were
+// a directory below its own path.
+type ArchiveEntry struct {
+	Path         string           `json:"path"`
+	Size         int64            `json:"size_bytes"`
+	Uncompressed int64            `json:"uncompressed_bytes"`
+	FileCount    int64            `json:"file_count"`
+	FileTypes    map[string]int64 `json:"types_bytes"`
+	TypeCounts   map[string]int64 `json:"types_files,omitempty"`
+	// Partial is set when the listing stopped early: on cancellation,
+	// once SlowThreshold ran out, or on a damaged archive.
+	Partial bool `json:"partial,omitempty"`
+}
+
+// errSlowArchive stops a listing that ran past the directory's deadline.
+var errSlowArchive = errors.New("slow archive")
+
+// archiveKind returns "zip", "tar" or "tgz" for names it can look into,
+// and "" for anything else.
+func archiveKind(name string) string {
+	n := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(n, ".zip"):
+		return "zip"
+	case strings.HasSuffix(n, ".tar"):
+		return "tar"
+	case strings.HasSuffix(n, ".tar.gz"), strings.HasSuffix(n, ".tgz"):
+		return "tgz"
+	}
+	return ""
+}
+
+// peekArchive lists the archive at p, records what it holds and returns
+// it. deadline, when not zero, is when the directory being read runs out
+// of time.
+func (w *walker) peekArchive(p string, size int64, deadline time.Time) ArchiveEntry {
+	a := ArchiveEntry{Path: p, Size: size, FileTypes: map[string]int64{}, TypeCounts: map[string]int64{}}
+	add := func(name string, n int64) error {
+		if err := w.ctx.Err(); err != nil {
+			return err
+		}
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			return errSlowArchive
+		}
+		a.Uncompressed += n
+		a.FileCount++
+		c := ClassifyExtension(path.Base(name))
+		a.FileTypes[c] += n
+		a.TypeCounts[c]++
+		return nil
+	}
+	var err error
+	if kind := archiveKind(p); kind == "zip" {
+		err = listZip(p, add)
+	} else {
+		err = listTar(w.ctx, p, kind == "tgz", add)
+	}
+	a.Partial = err != nil
+	w.archMu.Lock()
+	w.archives = append(w.archives, a)
+	w.archMu.Unlock()
+	return a
+}
+
+// archiveDir turns the archive a, described by fi and taking sz bytes
+// on disk in category c, into a virtual directory at its own path. It
+// keeps the archive's size on disk, so that totals do not change, and
+// splits that between the member categories in proportion to their
+// uncompressed sizes. FileCount counts the members.
+func (w *walker) archiveDir(a ArchiveEntry, fi os.FileInfo, sz int64, c string) *FolderSize {
+	mt := fi.ModTime()
+	d := &FolderSize{Path: a.Path, Size: sz, Total: sz, FileCount: a.FileCount, Oldest: mt, Newest: mt,
+		FileTypes: map[string]int64{}, TypeCounts: a.TypeCounts}
+	if w.opts.TrackLogical {
+		d.Logical = fi.Size()
+	}
+	if a.Partial {
+		d.Partial, d.SkipReason = true, SkipArchive
+	}
+	if a.Uncompressed == 0 {
+		d.FileTypes[c] = sz
+		return d
+	}
+	// Rounding leaves a few bytes over; the largest category takes them.
+	left, top := sz, ""
+	for cat, n := range a.FileTypes {
+		share := int64(float64(sz) * float64(n) / float64(a.Uncompressed))
+		d.FileTypes[cat] = share
+		left -= share
+		if top == "" || n > a.FileTypes[top] || n == a.FileTypes[top] && cat < top {
+			top = cat
+		}
+	}
+	d.FileTypes[top] += left
+	return d
+}
+
+// listZip calls add for every file in the zip at p. Only the central
+// directory is read.
+func listZip(p string, add func(string, int64) error) error {
+	r, err := zip.OpenReader(p)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		if err := add(f.Name, int64(f.UncompressedSize64)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// listTar calls add for every regular file in the tar at p, gunzipping it
+// first when gz is set. A compressed tar has to be read in full, so reads
+// give up as soon as ctx is cancelled.
+func listTar(ctx context.Context, p string, gz bool, add func(string, int64) error) error {
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if gz {
+		zr, err := gzip.NewReader(ctxReader{ctx, f})
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		r = zr
+	}
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if h.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := add(h.Name, h.Size); err != nil {
+			return err
+		}
+	}
+}
+
+// sortedArchives returns what was found in archives, largest uncompressed first.
+func (w *walker) sortedArchives() []ArchiveEntry {
+	out := w.archives
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Uncompressed != out[j].Uncompressed {
+			return out[i].Uncompressed > out[j].Uncompressed
+		}
+		return out[i].Path < out[j].Path
+	})
+	return out
+}
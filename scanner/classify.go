@@ -0,0 +1,194 @@
+package scanner
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// customExtensions and extraCategories hold user additions registered with
+// LoadClassifyConfig and AddCategory. They must be set up before scanning.
+var (
+	customExtensions = map[string]string{}
+	extraCategories  = map[string]bool{}
+)
+
+// categories lists every built-in category ClassifyExtension can return,
+// in a fixed order so tabular exports keep the same columns across runs.
+// See KnownCategories for the list including user-defined ones.
+var categories = []string{
+	"Image", "Video", "Audio", "Archive", "Document", "Application", "Code",
+	"Log", "Database", "Backup", "DB-Backup", "Disk Image", "Configuration",
+	"Font", "Web", "Spreadsheet", "Presentation", "Container", "Other",
+}
+
+// ClassifyExtension returns the category of a file from its name.
+func ClassifyExtension(n string) string {
+	if c, ok := customExtensions[strings.ToLower(filepath.Ext(n))]; ok {
+		return c
+	}
+	switch strings.ToLower(filepath.Base(n)) {
+	case "dockerfile", "containerfile":
+		return "Container"
+	case "makefile", "cmakelists.txt":
+		return "Code"
+	case "license", "readme", "changelog":
+		return "Document"
+	case ".gitignore", ".env":
+		return "Configuration"
+	}
+	switch strings.ToLower(filepath.Ext(n)) {
+	case ".jpg", ".jpeg", ".png", ".gif", ".bmp", ".tiff", ".raw", ".webp", ".heic", ".heif":
+		return "Image"
+	case ".mp4", ".mov", ".avi", ".mkv", ".flv", ".wmv", ".webm", ".m4v":
+		return "Video"
+	case ".mp3", ".wav", ".flac", ".aac", ".ogg", ".m4a", ".wma":
+		return "Audio"
+	case ".zip", ".rar", ".7z", ".tar", ".gz", ".bz2", ".xz":
+		return "Archive"
+	case ".pdf", ".doc", ".docx", ".txt", ".rtf":
+		return "Document"
+	case ".exe", ".dll", ".so", ".bin", ".dmg", ".pkg", ".apk":
+		return "Application"
+	case ".go", ".c", ".cpp", ".h", ".hpp", ".js", ".ts", ".py", ".java", ".sh", ".rb", ".php":
+		return "Code"
+	case ".log", ".trace":
+		return "Log"
+	case ".db", ".sqlite", ".sqlite3", ".rdb":
+		return "Database"
+	case ".bak", ".backup":
+		return "Backup"
+	case ".sql":
+		return "DB-Backup"
+	case ".iso", ".img", ".vhd", ".vhdx", ".vmdk":
+		return "Disk Image"
+	case ".conf", ".cfg", ".ini", ".yaml", ".yml", ".json", ".xml":
+		return "Configuration"
+	case ".ttf", ".otf", ".woff":
+		return "Font"
+	case ".html", ".htm", ".css":
+		return "Web"
+	case ".ods", ".xls", ".xlsx", ".csv":
+		return "Spreadsheet"
+	case ".odp", ".ppt", ".pptx":
+		return "Presentation"
+	default:
+		return "Other"
+	}
+}
+
+// LoadClassifyConfig reads a JSON object mapping extensions to categories,
+// e.g. {".parquet": "Data", "dcm": "Image"}, and merges it over the
+// built-in table.
+func LoadClassifyConfig(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var m map[string]string
+	if err := json.Unmarshal(b, &m); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	for ext, cat := range m {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if ext == "" || cat == "" {
+			return fmt.Errorf("%s: empty extension or category", path)
+		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		customExtensions[ext] = cat
+		AddCategory(cat)
+	}
+	return nil
+}
+
+// AddCategory registers a user category so KnownCategories lists it.
+func AddCategory(name string) {
+	for _, c := range categories {
+		if c == name {
+			return
+		}
+	}
+	extraCategories[name] = true
+}
+
+// KnownCategories returns the built-in categories followed by the user
+// defined ones in name order, with "Other" always last.
+func KnownCategories() []string {
+	out := append([]string(nil), categories[:len(categories)-1]...)
+	extra := make([]string, 0, len(extraCategories))
+	for c := range extraCategories {
+		extra = append(extra, c)
+	}
+	sort.Strings(extra)
+	return append(append(out, extra...), "Other")
+}
+
+// sniffCategory guesses the category of the file at p from its first 512
+// bytes. Anything unreadable or unrecognised stays "Other".
+func sniffCategory(p string) string {
+	f, err := os.Open(p)
+	if err != nil {
+		return "Other"
+	}
+	defer f.Close()
+	buf := make([]byte, 512)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return "Other"
+	}
+	return mimeCategory(http.DetectContentType(buf[:n]))
+}
+
+// mimeCategory maps a MIME type from http.DetectContentType to a category.
+func mimeCategory(mime string) string {
+	mime, _, _ = strings.Cut(mime, ";")
+	switch {
+	case strings.HasPrefix(mime, "image/"):
+		return "Image"
+	case strings.HasPrefix(mime, "video/"):
+		return "Video"
+	case strings.HasPrefix(mime, "audio/"), mime == "application/ogg":
+		return "Audio"
+	case strings.HasPrefix(mime, "font/"), mime == "application/vnd.ms-fontobject":
+		return "Font"
+	}
+	switch mime {
+	case "application/zip", "application/x-gzip", "application/x-rar-compressed":
+		return "Archive"
+	case "application/pdf", "application/postscript":
+		return "Document"
+	case "application/wasm":
+		return "Application"
+	case "text/html":
+		return "Web"
+	case "text/xml":
+		return "Configuration"
+	}
+	return "Other"
+}
+
+// namePattern collapses runs of digits so that numbered siblings such as
+// rotated logs or core dumps share one sniffing cache entry.
+func namePattern(name string) string {
+	var b strings.Builder
+	digits := false
+	for _, r := range name {
+		if r >= '0' && r <= '9' {
+			if !digits {
+				b.WriteByte('#')
+			}
+			digits = true
+			continue
+		}
+		digits = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,52 @@
+package scanner
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestClassifyExtension(t *testing.T) {
+	table := map[string][]string{
+		"Image":         {"a.jpg", "a.jpeg", "a.png", "a.gif", "a.bmp", "a.tiff", "a.raw", "a.webp", "a.heic", "a.heif"},
+		"Video":         {"a.mp4", "a.mov", "a.avi", "a.mkv", "a.flv", "a.wmv", "a.webm", "a.m4v"},
+		"Audio":         {"a.mp3", "a.wav", "a.flac", "a.aac", "a.ogg", "a.m4a", "a.wma"},
+		"Archive":       {"a.zip", "a.rar", "a.7z", "a.tar", "a.gz", "a.bz2", "a.xz"},
+		"Document":      {"a.pdf", "a.doc", "a.docx", "a.txt", "a.rtf", "LICENSE", "README", "ChangeLog"},
+		"Application":   {"a.exe", "a.dll", "a.so", "a.bin", "a.dmg", "a.pkg", "a.apk"},
+		"Code":          {"a.go", "a.c", "a.cpp", "a.h", "a.hpp", "a.js", "a.ts", "a.py", "a.java", "a.sh", "a.rb", "a.php", "Makefile", "CMakeLists.txt"},
+		"Log":           {"a.log", "a.trace"},
+		"Database":      {"a.db", "a.sqlite", "a.sqlite3", "a.rdb"},
+		"Backup":        {"a.bak", "a.backup"},
+		"DB-Backup":     {"a.sql"},
+		"Disk Image":    {"a.iso", "a.img", "a.vhd", "a.vhdx", "a.vmdk"},
+		"Configuration": {"a.conf", "a.cfg", "a.ini", "a.yaml", "a.yml", "a.json", "a.xml", ".gitignore", ".env"},
+		"Font":          {"a.ttf", "a.otf", "a.woff"},
+		"Web":           {"a.html", "a.htm", "a.css"},
+		"Spreadsheet":   {"a.ods", "a.xls", "a.xlsx", "a.csv"},
+		"Presentation":  {"a.odp", "a.ppt", "a.pptx"},
+		"Container":     {"Dockerfile", "Containerfile"},
+		"Other":         {"a", "a.unknown", "a.tar.zst", "notes.md"},
+	}
+	for cat, names := range table {
+		for _, n := range names {
+			if got := ClassifyExtension(n); got != cat {
+				t.Errorf("ClassifyExtension(%q) = %q, want %q", n, got, cat)
+			}
+			if up := strings.ToUpper(n); ClassifyExtension(up) != cat {
+				t.Errorf("ClassifyExtension(%q) = %q, want %q", up, ClassifyExtension(up), cat)
+			}
+			if p := "/data/x/" + n; ClassifyExtension(p) != cat {
+				t.Errorf("ClassifyExtension(%q) = %q, want %q", p, ClassifyExtension(p), cat)
+			}
+		}
+	}
+	known := map[string]bool{}
+	for _, c := range KnownCategories() {
+		known[c] = true
+	}
+	for c := range table {
+		if !known[c] {
+			t.Errorf("KnownCategories leaves out %q", c)
+		}
+	}
+}
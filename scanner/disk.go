@@ -0,0 +1,44 @@
+package scanner
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Disk is the capacity of the filesystem holding a path, in bytes. Free is
+// what an unprivileged user can still write, so Used + Free may fall short
+// of Total on filesystems that reserve blocks for root. Inodes and
+// InodesFree count file slots instead; they stay zero where the platform
+// does not report them or, as on btrfs, the filesystem has no fixed number.
+type Disk struct {
+	Total      int64 `json:"total_bytes"`
+	Used       int64 `json:"used_bytes"`
+	Free       int64 `json:"free_bytes"`
+	Inodes     int64 `json:"inodes_total,omitempty"`
+	InodesFree int64 `json:"inodes_free,omitempty"`
+}
+
+// IsMountRoot reports whether p is the top directory of its filesystem,
+// so that the filesystem's used space is what a scan of p will find. It
+// answers false where that cannot be told.
+func IsMountRoot(p string) bool {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return false
+	}
+	par := filepath.Dir(abs)
+	if par == abs {
+		return true
+	}
+	fi, err := os.Stat(abs)
+	if err != nil {
+		return false
+	}
+	pi, err := os.Stat(par)
+	if err != nil {
+		return false
+	}
+	d, ok := deviceID(fi)
+	pd, pok := deviceID(pi)
+	return ok && pok && d != pd
+}
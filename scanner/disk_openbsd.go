@@ -0,0 +1,19 @@
+package scanner
+
+import "syscall"
+
+// DiskUsage reports the capacity of the filesystem holding path.
+func DiskUsage(path string) (Disk, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return Disk{}, err
+	}
+	bs := uint64(st.F_bsize)
+	return Disk{
+		Total:      int64(st.F_blocks * bs),
+		Used:       int64((st.F_blocks - st.F_bfree) * bs),
+		Free:       int64(uint64(st.F_bavail) * bs),
+		Inodes:     int64(st.F_files),
+		InodesFree: int64(st.F_ffree),
+	}, nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !freebsd && !openbsd && !windows
+
+package scanner
+
+import "errors"
+
+// DiskUsage is unavailable on this platform.
+func DiskUsage(path string) (Disk, error) {
+	return Disk{}, errors.New("disk usage not supported on this platform")
+}
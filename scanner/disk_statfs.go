@@ -0,0 +1,21 @@
+//go:build linux || darwin || freebsd
+
+package scanner
+
+import "syscall"
+
+// DiskUsage reports the capacity of the filesystem holding path.
+func DiskUsage(path string) (Disk, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return Disk{}, err
+	}
+	bs := uint64(st.Bsize)
+	return Disk{
+		Total:      int64(uint64(st.Blocks) * bs),
+		Used:       int64((uint64(st.Blocks) - uint64(st.Bfree)) * bs),
+		Free:       int64(uint64(st.Bavail) * bs),
+		Inodes:     int64(st.Files),
+		InodesFree: int64(st.Ffree),
+	}, nil
+}
@@ -0,0 +1,23 @@
+package scanner
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+var getDiskFreeSpaceEx = syscall.NewLazyDLL("kernel32.dll").NewProc("GetDiskFreeSpaceExW")
+
+// DiskUsage reports the capacity of the volume holding path.
+func DiskUsage(path string) (Disk, error) {
+	p, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return Disk{}, err
+	}
+	var avail, total, free uint64
+	r, _, err := getDiskFreeSpaceEx.Call(uintptr(unsafe.Pointer(p)),
+		uintptr(unsafe.Pointer(&avail)), uintptr(unsafe.Pointer(&total)), uintptr(unsafe.Pointer(&free)))
+	if r == 0 {
+		return Disk{}, err
+	}
+	return Disk{Total: int64(total), Used: int64(total - free), Free: int64(avail)}, nil
+}
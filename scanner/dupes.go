@@ -0,0 +1,123 @@
+package scanner
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"sort"
+	"sync"
+)
+
+// DupeSet is a group of files with identical content.
+type DupeSet struct {
+	Size  int64    `json:"size_bytes"`
+	Hash  string   `json:"sha256"`
+	Paths []string `json:"paths"`
+}
+
+// Reclaimable is the space freed by keeping a single copy of the set.
+func (d DupeSet) Reclaimable() int64 {
+	return d.Size * int64(len(d.Paths)-1)
+}
+
+// addDupeCandidate remembers a file for duplicate detection under its
+// logical size.
+func (w *walker) addDupeCandidate(p string, size int64) {
+	w.dupeMu.Lock()
+	w.bySize[size] = append(w.bySize[size], p)
+	w.dupeMu.Unlock()
+}
+
+// findDupes hashes every file that shares its size with another candidate
+// and returns the sets of identical files, most reclaimable first. Only
+// files in same-size groups are read, using up to workers at a time.
+func (w *walker) findDupes(ctx context.Context, workers int) []DupeSet {
+	type job struct {
+		path string
+		size int64
+	}
+	jobs := make(chan job)
+	type key struct {
+		size int64
+		hash string
+	}
+	var mu sync.Mutex
+	groups := map[key][]string{}
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				h, err := hashFile(ctx, j.path)
+				if err != nil {
+					continue
+				}
+				mu.Lock()
+				k := key{j.size, h}
+				groups[k] = append(groups[k], j.path)
+				mu.Unlock()
+			}
+		}()
+	}
+feed:
+	for size, paths := range w.bySize {
+		if len(paths) < 2 {
+			continue
+		}
+		for _, p := range paths {
+			select {
+			case jobs <- job{p, size}:
+			case <-ctx.Done():
+				break feed
+			}
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	var sets []DupeSet
+	for k, paths := range groups {
+		if len(paths) < 2 {
+			continue
+		}
+		sort.Strings(paths)
+		sets = append(sets, DupeSet{Size: k.size, Hash: k.hash, Paths: paths})
+	}
+	sort.Slice(sets, func(i, j int) bool {
+		if a, b := sets[i].Reclaimable(), sets[j].Reclaimable(); a != b {
+			return a > b
+		}
+		return sets[i].Paths[0] < sets[j].Paths[0]
+	})
+	return sets
+}
+
+// hashFile returns the hex SHA-256 of the file at p, giving up as soon as
+// ctx is cancelled.
+func hashFile(ctx context.Context, p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, ctxReader{ctx, f}); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// ctxReader fails reads once ctx is done, so long copies stop promptly.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c ctxReader) Read(b []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(b)
+}
@@ -0,0 +1,117 @@
+package scanner
+
+import (
+	"context"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Estimate guesses the bytes a scan of root with opts would count, by
+// sampling for about budget instead of walking the whole tree. The top of
+// the tree is read in full, breadth first, until a few hundred directories
+// are waiting. Below each of those, probes descend into one random
+// subdirectory at a time and weigh the files they pass by how many
+// siblings each choice stood for, which averages out to the true size of
+// the subtree (Knuth's estimator). A lopsided tree can still put the
+// result off by a lot either way, so it only suits a progress percentage.
+//
+// Excludes, hidden directories and files, and OneFileSystem are honoured;
+// symlinks are not followed, hard links are counted every time, and
+// Includes, Since, Until and ExcludeCategories are ignored.
+func Estimate(ctx context.Context, root string, opts Options, budget time.Duration) (int64, error) {
+	if _, err := os.Stat(root); err != nil {
+		return 0, err
+	}
+	w := newWalker(root, opts)
+	start := time.Now()
+	var exact int64
+	frontier := []string{root}
+	for len(frontier) > 0 && len(frontier) < 256 && time.Since(start) < budget/4 && ctx.Err() == nil {
+		own, kids := w.sample(frontier[0])
+		exact += own
+		frontier = append(frontier[1:], kids...)
+	}
+	// Probes go round the frontier, so that every subtree gets at least
+	// one even when the budget is used up. An empty frontier means the
+	// whole tree was read.
+	sums := make([]float64, len(frontier))
+	counts := make([]int, len(frontier))
+	deadline := start.Add(budget)
+	var mu sync.Mutex
+	next := 0
+	var wg sync.WaitGroup
+	for i := 0; len(frontier) > 0 && i < max(opts.Workers, 1); i++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(seed))
+			for ctx.Err() == nil {
+				mu.Lock()
+				k := next
+				next++
+				mu.Unlock()
+				if k >= len(frontier) && time.Now().After(deadline) {
+					return
+				}
+				k %= len(frontier)
+				est := w.probe(ctx, frontier[k], rng)
+				mu.Lock()
+				sums[k] += est
+				counts[k]++
+				mu.Unlock()
+			}
+		}(time.Now().UnixNano() + int64(i))
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	total := float64(exact)
+	for k := range frontier {
+		if counts[k] > 0 {
+			total += sums[k] / float64(counts[k])
+		}
+	}
+	return int64(total), nil
+}
+
+// probe makes one random descent from dir for Estimate.
+func (w *walker) probe(ctx context.Context, dir string, rng *rand.Rand) float64 {
+	est, weight := 0.0, 1.0
+	for ctx.Err() == nil {
+		own, kids := w.sample(dir)
+		est += weight * float64(own)
+		if len(kids) == 0 {
+			break
+		}
+		weight *= float64(len(kids))
+		dir = kids[rng.Intn(len(kids))]
+	}
+	return est
+}
+
+// sample lists dir for Estimate: the bytes of its own files and the
+// subdirectories a scan would enter.
+func (w *walker) sample(dir string) (int64, []string) {
+	ents, _ := readDir(dir)
+	var own int64
+	var kids []string
+	for _, fi := range ents {
+		p := filepath.Join(dir, fi.Name())
+		hidden := strings.HasPrefix(fi.Name(), ".")
+		switch {
+		case fi.Mode()&os.ModeSymlink != 0:
+		case fi.IsDir():
+			if !(hidden && w.opts.NoHidden) && !w.opts.Excludes.Match(p) && !w.crossesDevice(p, fi) {
+				kids = append(kids, p)
+			}
+		case !(hidden && w.opts.NoHiddenFiles):
+			own += w.fileSize(fi)
+		}
+	}
+	return own, kids
+}
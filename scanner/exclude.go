@@ -0,0 +1,185 @@
+package scanner
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+// ExcludeRules decides which directories the scan leaves out. A directory
+// is excluded when any rule matches it.
+type ExcludeRules struct {
+	Prefixes   []string         // directories excluded with everything below them
+	Globs      []string         // shell globs, see globMatch
+	Regexps    []*regexp.Regexp // matched against the cleaned absolute path
+	NoDefaults bool             // disables the built-in proc/sys/dev/... skip list
+	// FoldCase matches prefixes, globs and the built-in list regardless
+	// of case. CaseInsensitive sets it and makes the regexps follow.
+	FoldCase bool
+}
+
+// CaseInsensitiveFS tells whether the filesystems of this OS usually
+// ignore case in names, as NTFS and the default APFS do and the Linux
+// ones do not.
+var CaseInsensitiveFS = runtime.GOOS == "windows" || runtime.GOOS == "darwin"
+
+// CaseInsensitive returns r matching regardless of case.
+func (r ExcludeRules) CaseInsensitive() ExcludeRules {
+	r.FoldCase = true
+	res := make([]*regexp.Regexp, len(r.Regexps))
+	for i, re := range r.Regexps {
+		res[i] = regexp.MustCompile("(?i)" + re.String())
+	}
+	r.Regexps = res
+	return r
+}
+
+// Match reports whether the directory p is excluded.
+func (r ExcludeRules) Match(p string) bool {
+	return r.Rule(p) != ""
+}
+
+// Rule describes the first rule excluding the directory p, such as
+// `glob "**/node_modules"`, or returns "" when p is not excluded.
+func (r ExcludeRules) Rule(p string) string {
+	fold := func(s string) string {
+		if r.FoldCase {
+			return strings.ToLower(s)
+		}
+		return s
+	}
+	for _, e := range r.Prefixes {
+		if isWithin(fold(p), fold(e)) {
+			return fmt.Sprintf("prefix %q", e)
+		}
+	}
+	for _, g := range r.Globs {
+		if globMatch(fold(g), fold(p)) {
+			return fmt.Sprintf("glob %q", g)
+		}
+	}
+	if len(r.Regexps) > 0 {
+		ap := filepath.Clean(p)
+		if abs, err := filepath.Abs(ap); err == nil {
+			ap = abs
+		}
+		for _, re := range r.Regexps {
+			if re.MatchString(ap) {
+				return fmt.Sprintf("regexp %q", re)
+			}
+		}
+	}
+	if r.NoDefaults {
+		return ""
+	}
+	switch b := fold(filepath.Base(p)); b {
+	case "proc", "sys", "dev", "run", "tmp", "var":
+		return fmt.Sprintf("default %q", b)
+	default:
+		return ""
+	}
+}
+
+// globMatch matches p against a shell glob where each path element is
+// matched with filepath.Match and a "**" element spans any number of
+// directories. Absolute patterns are anchored at the filesystem root;
+// relative ones may match any trailing part of p, so "node_modules",
+// "*/.git" and "**/cache/*" behave as they would in a .gitignore.
+func globMatch(pattern, p string) bool {
+	pat := splitPath(pattern)
+	segs := splitPath(p)
+	if strings.HasPrefix(filepath.ToSlash(pattern), "/") {
+		return matchSegments(pat, segs)
+	}
+	for i := range segs {
+		if matchSegments(pat, segs[i:]) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchSegments(pat, segs []string) bool {
+	for len(pat) > 0 {
+		if pat[0] == "**" {
+			for i := 0; i <= len(segs); i++ {
+				if matchSegments(pat[1:], segs[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segs) == 0 {
+			return false
+		}
+		if ok, _ := filepath.Match(pat[0], segs[0]); !ok {
+			return false
+		}
+		pat, segs = pat[1:], segs[1:]
+	}
+	return len(segs) == 0
+}
+
+// splitPath breaks p into its non-empty slash-separated elements.
+func splitPath(p string) []string {
+	var out []string
+	for _, s := range strings.Split(filepath.ToSlash(p), "/") {
+		if s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// ValidGlob reports a syntax error in any element of pattern.
+func ValidGlob(pattern string) error {
+	for _, s := range splitPath(pattern) {
+		if _, err := filepath.Match(s, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadExcludeFile reads exclude rules from the file at path, one per line.
+// Blank lines and lines starting with # are ignored. A line starting with
+// "re:" is a regexp, one containing *, ? or [ is a glob and anything else
+// a path prefix. Every pattern is validated; errors name the line.
+func ReadExcludeFile(path string) (ExcludeRules, error) {
+	var r ExcludeRules
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return r, err
+	}
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+		case strings.HasPrefix(line, "re:"):
+			re, err := regexp.Compile(strings.TrimPrefix(line, "re:"))
+			if err != nil {
+				return r, fmt.Errorf("%s:%d: %v", path, i+1, err)
+			}
+			r.Regexps = append(r.Regexps, re)
+		case strings.ContainsAny(line, "*?["):
+			if err := ValidGlob(line); err != nil {
+				return r, fmt.Errorf("%s:%d: %v", path, i+1, err)
+			}
+			r.Globs = append(r.Globs, line)
+		default:
+			r.Prefixes = append(r.Prefixes, line)
+		}
+	}
+	return r, nil
+}
+
+// With returns r extended by the rules of o. NoDefaults is kept from r.
+func (r ExcludeRules) With(o ExcludeRules) ExcludeRules {
+	r.Prefixes = append(append([]string(nil), r.Prefixes...), o.Prefixes...)
+	r.Globs = append(append([]string(nil), r.Globs...), o.Globs...)
+	r.Regexps = append(append([]*regexp.Regexp(nil), r.Regexps...), o.Regexps...)
+	return r
+}
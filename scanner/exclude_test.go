@@ -0,0 +1,64 @@
+package scanner
+
+import "testing"
+
+func TestGlobMatch(t *testing.T) {
+	for _, c := range []struct {
+		pattern, p string
+		want       bool
+	}{
+		{"node_modules", "/src/app/node_modules", true},
+		{"node_modules", "/src/app/node_modules_old", false},
+		{"*.cache", "/home/u/.npm.cache", true},
+		{"**/node_modules", "/src/app/node_modules", true},
+		{"**/node_modules", "/node_modules", true},
+		{"**/node_modules", "/src/node_modules/pkg", false},
+		{"*/.git", "/src/app/.git", true},
+		{"*/.git", "/.git", false},
+		{"**/cache/*", "/var/lib/cache/apt", true},
+		{"/home/*/Downloads", "/home/u/Downloads", true},
+		{"/home/*/Downloads", "/mnt/home/u/Downloads", false},
+		{"/srv/**/logs", "/srv/a/b/logs", true},
+		{"/srv/**/logs", "/srv/logs", true},
+		{"app/build", "/src/app/build", true},
+		{"app/build", "/src/myapp/build", false},
+	} {
+		if got := globMatch(c.pattern, c.p); got != c.want {
+			t.Errorf("globMatch(%q, %q) = %v, want %v", c.pattern, c.p, got, c.want)
+		}
+	}
+}
+
+func TestExcludeRules(t *testing.T) {
+	r := ExcludeRules{
+		Prefixes: []string{"/srv/backup"},
+		Globs:    []string{"**/node_modules", "*/.git"},
+	}
+	for _, c := range []struct {
+		p    string
+		want string
+	}{
+		{"/srv/backup", `prefix "/srv/backup"`},
+		{"/srv/backup/2024", `prefix "/srv/backup"`},
+		{"/srv/backups", ""},
+		{"/src/app/node_modules", `glob "**/node_modules"`},
+		{"/src/app/.git", `glob "*/.git"`},
+		{"/src/app", ""},
+		{"/proc", `default "proc"`},
+	} {
+		if got := r.Rule(c.p); got != c.want {
+			t.Errorf("Rule(%q) = %q, want %q", c.p, got, c.want)
+		}
+	}
+	r.NoDefaults = true
+	if r.Match("/proc") {
+		t.Error("NoDefaults still excludes /proc")
+	}
+	r.Globs = []string{"**/Cache"}
+	if r.Match("/home/u/cache") {
+		t.Error("a glob matched a name of other case")
+	}
+	if !r.CaseInsensitive().Match("/home/u/cache") {
+		t.Error("CaseInsensitive did not fold the glob")
+	}
+}
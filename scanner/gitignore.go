@@ -0,0 +1,96 @@
+package scanner
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ignoreLayer holds the rules of one .gitignore file. Layers are chained to
+// the layer of the nearest ancestor directory with a .gitignore, so rules
+// apply to the whole subtree and deeper files override shallower ones.
+type ignoreLayer struct {
+	base   string
+	rules  []ignoreRule
+	parent *ignoreLayer
+}
+
+type ignoreRule struct {
+	segs     []string // pattern split on "/"
+	negate   bool     // "!pattern" re-includes a path
+	dirOnly  bool     // "pattern/" only matches directories
+	anchored bool     // pattern contains a "/" and is relative to base
+}
+
+// loadGitignore returns a new layer for dir's .gitignore on top of parent,
+// or parent itself when dir has none.
+func loadGitignore(dir string, parent *ignoreLayer) *ignoreLayer {
+	f, err := os.Open(filepath.Join(dir, ".gitignore"))
+	if err != nil {
+		return parent
+	}
+	defer f.Close()
+	l := &ignoreLayer{base: dir, parent: parent}
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var r ignoreRule
+		if strings.HasPrefix(line, "!") {
+			r.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, `\`) {
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			r.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		r.anchored = strings.Contains(line, "/")
+		r.segs = splitPath(line)
+		if len(r.segs) == 0 {
+			continue
+		}
+		l.rules = append(l.rules, r)
+	}
+	if len(l.rules) == 0 {
+		return parent
+	}
+	return l
+}
+
+// ignored reports whether p is ignored by l or any of its ancestors. As in
+// git, the last matching rule wins and deeper files are consulted last.
+func (l *ignoreLayer) ignored(p string, isDir bool) bool {
+	if l == nil {
+		return false
+	}
+	ign := l.parent.ignored(p, isDir)
+	rel, err := filepath.Rel(l.base, p)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return ign
+	}
+	segs := splitPath(rel)
+	for _, r := range l.rules {
+		if r.dirOnly && !isDir {
+			continue
+		}
+		if r.match(segs) {
+			ign = !r.negate
+		}
+	}
+	return ign
+}
+
+func (r ignoreRule) match(segs []string) bool {
+	if r.anchored {
+		return matchSegments(r.segs, segs)
+	}
+	if len(segs) == 0 {
+		return false
+	}
+	return matchSegments(r.segs, segs[len(segs)-1:])
+}
@@ -0,0 +1,60 @@
+package scanner
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// included reports whether dir matches one of the Includes globs itself,
+// which puts it and everything below it in the scan.
+func (w *walker) included(dir string) bool {
+	for _, g := range w.opts.Includes {
+		if globMatch(g, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// includedRoot is included for the root, which is also inside the scan
+// when one of its ancestors matches.
+func (w *walker) includedRoot(root string) bool {
+	for p := root; ; p = filepath.Dir(p) {
+		if w.included(p) {
+			return true
+		}
+		if filepath.Dir(p) == p {
+			return false
+		}
+	}
+}
+
+// mayLead reports whether something below dir could still match one of
+// the Includes globs, so that dir has to be walked. Only absolute
+// patterns allow pruning; a relative one can match anywhere.
+func (w *walker) mayLead(dir string) bool {
+	segs := splitPath(dir)
+	for _, g := range w.opts.Includes {
+		if !strings.HasPrefix(filepath.ToSlash(g), "/") || prefixSegments(splitPath(g), segs) {
+			return true
+		}
+	}
+	return false
+}
+
+// prefixSegments reports whether segs can be extended into a path that
+// pat matches.
+func prefixSegments(pat, segs []string) bool {
+	for ; len(segs) > 0; pat, segs = pat[1:], segs[1:] {
+		if len(pat) == 0 {
+			return false
+		}
+		if pat[0] == "**" {
+			return true
+		}
+		if ok, _ := filepath.Match(pat[0], segs[0]); !ok {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,102 @@
+package scanner
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// previous is an earlier scan prepared for reuse: the records reduced back
+// to the files directly inside each directory, and each directory's
+// subdirectories.
+type previous struct {
+	own  map[string]*FolderSize
+	kids map[string][]string
+}
+
+// newPrevious undoes AggregateTotals on the records of an earlier scan.
+// Oldest and Newest cannot be split apart again and keep their subtree
+// values, which is harmless once they are rolled up anew.
+func newPrevious(m map[string]*FolderSize) *previous {
+	pv := &previous{own: make(map[string]*FolderSize, len(m)), kids: map[string][]string{}}
+	for p, fs := range m {
+		o := *fs
+		o.Total = fs.Size
+		o.FileTypes = make(map[string]int64, len(fs.FileTypes))
+		for c, s := range fs.FileTypes {
+			o.FileTypes[c] = s
+		}
+		o.TypeCounts = make(map[string]int64, len(fs.TypeCounts))
+		for c, n := range fs.TypeCounts {
+			o.TypeCounts[c] = n
+		}
+		pv.own[p] = &o
+	}
+	for p, fs := range m {
+		par := filepath.Dir(p)
+		o := pv.own[par]
+		if par == p || o == nil {
+			continue
+		}
+		pv.kids[par] = append(pv.kids[par], p)
+		o.FileCount -= fs.FileCount
+		o.SubdirCount -= fs.SubdirCount
+		o.DirBytes -= fs.DirBytes
+		o.Logical -= fs.Logical
+		for c, s := range fs.FileTypes {
+			o.FileTypes[c] -= s
+		}
+		for c, n := range fs.TypeCounts {
+			o.TypeCounts[c] -= n
+		}
+	}
+	return pv
+}
+
+// reuse fills res from the previous scan when dir was read completely then
+// and its mtime has not changed since, which means no entry was added,
+// removed or renamed in it. The subdirectories known from back then are
+// queued to be checked in turn, so a directory is only reused when all of
+// them have records; an interrupted scan leaves some out. It reports
+// false when dir must be read.
+func (w *walker) reuse(qd queuedDir, mtime time.Time, res *dirResult) bool {
+	if w.prev == nil || mtime.IsZero() || w.opts.MaxDepth >= 0 && qd.depth >= w.opts.MaxDepth || !w.opts.Since.IsZero() || !w.opts.Until.IsZero() || w.dropCats != nil || len(w.opts.Includes) > 0 || w.opts.CountDirOverhead || w.opts.TrackLogical || w.opts.PeekArchives {
+		return false
+	}
+	old := w.prev.own[qd.path]
+	if old == nil || old.Skipped || old.Partial || !old.DirMtime.Equal(mtime) || old.SubdirCount != int64(len(w.prev.kids[qd.path])) {
+		return false
+	}
+	fs := *old
+	fs.DirBytes, fs.Logical = 0, 0
+	fs.FileTypes = make(map[string]int64, len(old.FileTypes))
+	for c, s := range old.FileTypes {
+		fs.FileTypes[c] = s
+	}
+	fs.TypeCounts = make(map[string]int64, len(old.TypeCounts))
+	for c, n := range old.TypeCounts {
+		fs.TypeCounts[c] = n
+	}
+	*res.fs = fs
+	ign := qd.ignore
+	if w.opts.UseGitignore {
+		ign = loadGitignore(qd.path, ign)
+	}
+	for _, p := range w.prev.kids[qd.path] {
+		fi, err := os.Stat(p)
+		if err != nil || !fi.IsDir() || w.opts.NoHidden && strings.HasPrefix(fi.Name(), ".") || ign.ignored(p, true) {
+			continue
+		}
+		if w.crossesDevice(p, fi) {
+			mnt := &FolderSize{Path: p, FileTypes: map[string]int64{}}
+			mnt.skip(SkipCrossedFS, nil)
+			res.mounts = append(res.mounts, mnt)
+			continue
+		}
+		res.kids = append(res.kids, queuedDir{path: p, depth: qd.depth + 1, ignore: ign, mtime: fi.ModTime()})
+	}
+	atomic.AddInt64(&w.stats.Reused, 1)
+	return true
+}
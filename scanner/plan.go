@@ -0,0 +1,63 @@
+package scanner
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PlanEntry is one immediate subdirectory of the root as a scan with the
+// same options would treat it. Reason is empty when it would be scanned.
+type PlanEntry struct {
+	Path   string
+	Reason string
+}
+
+// Plan lists the immediate subdirectories of root and why each would be
+// left out, without walking any of them. Reasons are SkipExcluded,
+// SkipCrossedFS, "hidden", "gitignored" or "symlink", followed by the
+// matching exclude rule where there is one.
+func Plan(root string, opts Options) ([]PlanEntry, error) {
+	ents, err := ioutil.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+	w := newWalker(root, opts)
+	var ign *ignoreLayer
+	if opts.UseGitignore {
+		ign = loadGitignore(root, nil)
+	}
+	var plan []PlanEntry
+	for _, fi := range ents {
+		p := filepath.Join(root, fi.Name())
+		if fi.Mode()&os.ModeSymlink != 0 {
+			ti, ok := w.linkedDir(p)
+			if !opts.FollowSymlinks || !ok {
+				if ti, err := os.Stat(p); err == nil && ti.IsDir() {
+					plan = append(plan, PlanEntry{p, "symlink"})
+				}
+				continue
+			}
+			fi = ti
+		}
+		if !fi.IsDir() {
+			continue
+		}
+		e := PlanEntry{Path: p}
+		switch {
+		case ign.ignored(p, true):
+			e.Reason = "gitignored"
+		case opts.NoHidden && strings.HasPrefix(fi.Name(), "."):
+			e.Reason = "hidden"
+		case w.crossesDevice(p, fi):
+			e.Reason = SkipCrossedFS
+		default:
+			if r := opts.Excludes.Rule(p); r != "" {
+				e.Reason = SkipExcluded + " by " + r
+			}
+		}
+		plan = append(plan, e)
+	}
+	return plan, nil
+}
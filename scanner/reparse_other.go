@@ -0,0 +1,18 @@
+//go:build !windows
+
+package scanner
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// isReparsePoint is always false outside Windows; symlinks carry
+// os.ModeSymlink there.
+func isReparsePoint(fi os.FileInfo) bool { return false }
+
+// realPath resolves the symlinks in p.
+func realPath(p string) (string, error) { return filepath.EvalSymlinks(p) }
+
+// dirKey is not needed outside Windows, where realPath sees every link.
+func dirKey(p string) (fileKey, bool) { return fileKey{}, false }
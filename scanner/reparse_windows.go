@@ -0,0 +1,49 @@
+//go:build windows
+
+package scanner
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// isReparsePoint reports whether fi, as returned by Lstat or ReadDir,
+// is a junction, mount point or other reparse point rather than a plain
+// directory. Such entries are treated like symlinks.
+func isReparsePoint(fi os.FileInfo) bool {
+	d, ok := fi.Sys().(*syscall.Win32FileAttributeData)
+	return ok && d.FileAttributes&syscall.FILE_ATTRIBUTE_REPARSE_POINT != 0
+}
+
+// realPath resolves p through a junction at its last element as well as
+// through symlinks, which is all filepath.EvalSymlinks does.
+func realPath(p string) (string, error) {
+	if t, err := os.Readlink(p); err == nil {
+		if !filepath.IsAbs(t) {
+			t = filepath.Join(filepath.Dir(p), t)
+		}
+		p = t
+	}
+	return filepath.EvalSymlinks(p)
+}
+
+// dirKey identifies the directory at p by volume serial number and file
+// index, which stay the same however the directory is reached.
+func dirKey(p string) (fileKey, bool) {
+	name, err := syscall.UTF16PtrFromString(p)
+	if err != nil {
+		return fileKey{}, false
+	}
+	h, err := syscall.CreateFile(name, 0, syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE|syscall.FILE_SHARE_DELETE,
+		nil, syscall.OPEN_EXISTING, syscall.FILE_FLAG_BACKUP_SEMANTICS, 0)
+	if err != nil {
+		return fileKey{}, false
+	}
+	defer syscall.CloseHandle(h)
+	var info syscall.ByHandleFileInformation
+	if err := syscall.GetFileInformationByHandle(h, &info); err != nil {
+		return fileKey{}, false
+	}
+	return fileKey{dev: uint64(info.VolumeSerialNumber), ino: uint64(info.FileIndexHigh)<<32 | uint64(info.FileIndexLow)}, true
+}
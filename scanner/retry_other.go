@@ -0,0 +1,7 @@
+//go:build !unix && !windows
+
+package scanner
+
+// retryable is always false where the transient errors of network
+// filesystems are not known.
+func retryable(err error) bool { return false }
@@ -0,0 +1,23 @@
+//go:build unix
+
+package scanner
+
+import (
+	"errors"
+	"syscall"
+)
+
+// retryable reports whether err is one network filesystems return while
+// a server is briefly unreachable or a handle went stale, so that reading
+// again may well succeed.
+func retryable(err error) bool {
+	var errno syscall.Errno
+	if !errors.As(err, &errno) {
+		return false
+	}
+	switch errno {
+	case syscall.ESTALE, syscall.ETIMEDOUT, syscall.EIO, syscall.EINTR, syscall.EAGAIN, syscall.EHOSTDOWN:
+		return true
+	}
+	return false
+}
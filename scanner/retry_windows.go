@@ -0,0 +1,33 @@
+//go:build windows
+
+package scanner
+
+import (
+	"errors"
+	"syscall"
+)
+
+// Windows errors for a network share that dropped or timed out, which the
+// syscall package does not name.
+const (
+	errorBadNetPath     syscall.Errno = 53
+	errorNetworkBusy    syscall.Errno = 54
+	errorBadNetResp     syscall.Errno = 58
+	errorUnexpNetErr    syscall.Errno = 59
+	errorNetnameDeleted syscall.Errno = 64
+	errorSemTimeout     syscall.Errno = 121
+)
+
+// retryable reports whether err is one SMB shares return while the server
+// is briefly unreachable, so that reading again may well succeed.
+func retryable(err error) bool {
+	var errno syscall.Errno
+	if !errors.As(err, &errno) {
+		return false
+	}
+	switch errno {
+	case errorBadNetPath, errorNetworkBusy, errorBadNetResp, errorUnexpNetErr, errorNetnameDeleted, errorSemTimeout:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,908 @@
+// Package scanner walks a directory tree and accounts the size, file count,
+// age span and type mix of every directory in it. It is the engine behind
+// the find-large-dirs command and can be embedded in other programs:
+//
+//	m, err := scanner.Scan(ctx, "/srv", scanner.DefaultOptions())
+//	scanner.AggregateTotals(m)
+package scanner
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// FolderSize is the accounting of one directory. Size covers only the files
+// directly inside it; Total, FileCount, SubdirCount, Oldest, Newest,
+// FileTypes and TypeCounts cover the whole subtree once AggregateTotals has
+// run.
+type FolderSize struct {
+	Path      string `json:"path"`
+	Size      int64  `json:"size_bytes"`
+	Total     int64  `json:"total_bytes"`
+	FileCount int64  `json:"file_count"`
+	// SubdirCount is the number of subdirectories scanned below it.
+	SubdirCount int64     `json:"subdir_count"`
+	Oldest      time.Time `json:"oldest_mtime"`
+	Newest      time.Time `json:"newest_mtime"`
+	// DirMtime is the modification time of the directory itself, which
+	// changes whenever an entry is added, removed or renamed in it.
+	DirMtime time.Time `json:"dir_mtime,omitempty"`
+	Skipped  bool      `json:"skipped"`
+	// Partial is set when only some of the files directly inside were
+	// counted; its subdirectories are still scanned.
+	Partial bool `json:"partial,omitempty"`
+	// SkipReason says why Skipped or Partial is set, one of the Skip*
+	// constants. SkipError carries the error text for SkipPermission and
+	// SkipReadError.
+	SkipReason string           `json:"skip_reason,omitempty"`
+	SkipError  string           `json:"skip_error,omitempty"`
+	FileTypes  map[string]int64 `json:"types_bytes"`
+	TypeCounts map[string]int64 `json:"types_files,omitempty"`
+	// Fingerprint hashes the names, sizes and mtimes of the files directly
+	// inside, so that contents replaced by others of the same size show up
+	// as a change. It is only set with Options.TrackChurn and stays empty
+	// for Partial directories; it is not rolled up.
+	Fingerprint string `json:"fingerprint,omitempty"`
+	// DirBytes is the space the directories of the subtree take
+	// themselves, not their files. It is only set with
+	// Options.CountDirOverhead and is included in Total but not in Size.
+	DirBytes int64 `json:"dir_bytes,omitempty"`
+	// Logical is the sum of the file sizes of the subtree as ls shows
+	// them, counted like Size otherwise. Well below Total it means
+	// compression or sparse files at work. Only set with
+	// Options.TrackLogical.
+	Logical int64 `json:"logical_bytes,omitempty"`
+}
+
+// Reasons a directory ends up Skipped.
+const (
+	SkipPermission = "permission denied"
+	SkipSlow       = "slow"
+	SkipSlowList   = "slow listing"
+	SkipReadError  = "read error"
+	SkipExcluded   = "excluded"
+	SkipCrossedFS  = "crossed filesystem"
+	SkipLoop       = "symlink loop"
+	// SkipVanished is a directory deleted while the scan ran. On a busy
+	// system that is normal rather than an error.
+	SkipVanished = "vanished"
+	// SkipArchive marks the virtual directory of an archive that
+	// PeekArchives could only list in part.
+	SkipArchive = "archive listed in part"
+)
+
+// skip marks fs Skipped for reason, keeping the text of err if there is one.
+func (fs *FolderSize) skip(reason string, err error) {
+	fs.Skipped = true
+	fs.SkipReason = reason
+	if err != nil {
+		fs.SkipError = err.Error()
+	}
+}
+
+// Progress is sent on Options.Progress after each directory is read.
+type Progress struct {
+	CurrentDir string `json:"current_dir"`
+	NumDirs    int64  `json:"num_dirs"`
+	BytesTotal int64  `json:"bytes_total"`
+}
+
+// Options controls a scan. Start from DefaultOptions; the zero value folds
+// the whole tree into the root because MaxDepth is 0.
+type Options struct {
+	Excludes ExcludeRules
+	// Includes, when not empty, restricts the accounting to directories
+	// matching one of these globs (see ExcludeRules.Globs) and everything
+	// below them. Other directories are only walked as far as a match
+	// could still lie below them, and their own files are not counted.
+	// Excludes still apply inside included directories.
+	Includes []string
+	// SlowThreshold stops counting the files of a directory once that has
+	// taken longer than this and marks it Partial; its subdirectories are
+	// still scanned. SlowDirThreshold instead skips a directory and its
+	// whole subtree when listing its entries alone takes longer. Zero or
+	// negative disables either check.
+	SlowThreshold    time.Duration
+	SlowDirThreshold time.Duration
+	Workers          int
+	OneFileSystem    bool
+	// IncludeMounts are mount points OneFileSystem still descends into,
+	// together with everything below them.
+	IncludeMounts []string
+	ApparentSize  bool
+	CountLinks    bool
+	// FollowSymlinks descends into symlinked directories that resolve
+	// inside the root; FollowExternal also allows targets outside it.
+	// Windows junctions and other reparse points count as symlinks and
+	// are left out entirely otherwise.
+	FollowSymlinks bool
+	FollowExternal bool
+	// MaxDepth folds everything deeper than this many levels below the
+	// root into its ancestor at that level. Negative means unlimited.
+	MaxDepth int
+	// Sniff reads the head of "Other" files of at least SniffMinSize bytes
+	// to guess their category from content.
+	Sniff        bool
+	SniffMinSize int64
+	// UseGitignore skips whatever .gitignore files along the way ignore.
+	UseGitignore bool
+	// NoHidden leaves out directories whose name starts with a dot, and
+	// NoHiddenFiles leaves such files out of the accounting. The root is
+	// always scanned.
+	NoHidden      bool
+	NoHiddenFiles bool
+	// FindDupes hashes regular files of at least DupeMinSize bytes that
+	// share their size with another one and reports identical sets in
+	// Stats.Dupes. Hard links to one inode count as a single file.
+	FindDupes   bool
+	DupeMinSize int64
+	// TopFiles, when positive, keeps that many of the largest files of at
+	// least MinFileSize bytes in Stats.TopFiles.
+	TopFiles    int
+	MinFileSize int64
+	// Since and Until, when not zero, leave out of the accounting every
+	// file modified before Since or after Until. Directories are still
+	// walked and counted as subdirectories.
+	Since time.Time
+	Until time.Time
+	// ExcludeCategories leaves the files of these categories out of the
+	// accounting altogether, as if they were not there.
+	ExcludeCategories []string
+	// TrackChurn fills FolderSize.Fingerprint, which costs a sort and a
+	// hash per directory and the memory to keep the result.
+	TrackChurn bool
+	// PeekArchives lists the members of .zip, .tar and .tar.gz files of at
+	// least PeekMinSize bytes and reports them in Stats.Archives. Each such
+	// archive also becomes a virtual directory at its own path, still at
+	// its size on disk but with the type mix and file count of its
+	// members, unless MaxDepth folds it into an ancestor.
+	PeekArchives bool
+	PeekMinSize  int64
+	// CountDirOverhead adds the space each directory takes itself, as its
+	// Lstat reports it, to Total and keeps it apart in DirBytes.
+	CountDirOverhead bool
+	// Retries is how many more times a directory is read after a
+	// transient error of a network filesystem, such as a stale NFS handle
+	// or a timeout, waiting RetryDelay before the first retry and twice
+	// as long before each further one.
+	Retries    int
+	RetryDelay time.Duration
+	// TrackLogical fills FolderSize.Logical, to compare with the space
+	// the files take on disk.
+	TrackLogical bool
+	// TimeDirs records in Stats.DirTimes how long each directory took to
+	// read, for tuning SlowThreshold.
+	TimeDirs bool
+	// Previous holds the records of an earlier scan of the same root, as
+	// rolled up by AggregateTotals. Directories whose mtime is unchanged
+	// since then are not read again; their own files are taken from there.
+	// Files edited in place do not touch their directory's mtime, so their
+	// new sizes are missed, as are hard links, duplicates, sniffing and
+	// the age histogram for reused directories. The caller must make sure
+	// the earlier scan counted with the same ApparentSize, CountLinks,
+	// hidden, gitignore and symlink options.
+	Previous map[string]*FolderSize
+	// Progress, when set, receives an update after every directory.
+	Progress chan<- Progress
+	// Emit, when set, receives every directory as soon as it is read.
+	// Records are then neither retained nor folded by MaxDepth.
+	Emit func(*FolderSize)
+}
+
+// DefaultOptions returns the settings the command line starts from.
+func DefaultOptions() Options {
+	return Options{
+		SlowThreshold: 2 * time.Second,
+		Workers:       runtime.NumCPU(),
+		MaxDepth:      -1,
+		SniffMinSize:  1 << 20,
+		DupeMinSize:   1 << 20,
+		PeekMinSize:   10 << 20,
+	}
+}
+
+// queuedDir is a directory waiting to be read, its depth below the root,
+// the .gitignore rules inherited from its ancestors and its own mtime.
+type queuedDir struct {
+	path     string
+	depth    int
+	ignore   *ignoreLayer
+	mtime    time.Time // of the directory itself, zero when not known yet
+	included bool      // inside a directory matching Options.Includes
+}
+
+// dirResult is what scanDir learned about one directory.
+type dirResult struct {
+	fs     *FolderSize
+	kids   []queuedDir   // subdirectories to scan next
+	mounts []*FolderSize // subdirectories left out as mount points
+	// archives are the archives shown as virtual subdirectories.
+	archives []*FolderSize
+}
+
+// Stats carries scan-wide counters that don't belong to any single
+// directory.
+type Stats struct {
+	BytesScanned int64
+	LinkedBytes  int64 // bytes of extra hard links counted only once
+	Sniffed      int64 // "Other" files reclassified by content sniffing
+	Reused       int64 // directories taken from Options.Previous unread
+	Denied       int64 // directories skipped with SkipPermission
+	// AgeBytes buckets the bytes counted by file age, see AgeBuckets.
+	AgeBytes [len(AgeBuckets) + 1]int64
+	// Dupes lists the sets of identical files when FindDupes is on.
+	Dupes []DupeSet
+	// TopFiles lists the largest files, largest first, see Options.TopFiles.
+	TopFiles []FileEntry
+	// Archives lists what PeekArchives found, largest uncompressed first.
+	Archives []ArchiveEntry
+	// DirTimes holds how long each directory took when TimeDirs is on,
+	// in no particular order.
+	DirTimes []time.Duration
+}
+
+// walker holds the per-scan state shared by all workers.
+type walker struct {
+	stats   Stats // first, for 64-bit atomic alignment on 32-bit platforms
+	opts    Options
+	ctx     context.Context
+	now     time.Time
+	rootDev uint64
+	haveDev bool
+
+	linkMu sync.Mutex
+	seen   map[fileKey]struct{}
+
+	realRoot string
+	visitMu  sync.Mutex
+	visited  map[string]struct{}
+
+	sniffMu    sync.Mutex
+	sniffCache map[string]string
+
+	dupeMu sync.Mutex
+	bySize map[int64][]string
+
+	prev *previous
+
+	topMu sync.Mutex
+	top   fileHeap
+
+	archMu   sync.Mutex
+	archives []ArchiveEntry
+
+	mounts   []string        // resolved IncludeMounts
+	dropCats map[string]bool // ExcludeCategories
+}
+
+func newWalker(root string, opts Options) *walker {
+	w := &walker{
+		opts:       opts,
+		now:        time.Now(),
+		seen:       map[fileKey]struct{}{},
+		visited:    map[string]struct{}{},
+		sniffCache: map[string]string{},
+		bySize:     map[int64][]string{},
+	}
+	if opts.OneFileSystem {
+		if fi, err := os.Stat(root); err == nil {
+			w.rootDev, w.haveDev = deviceID(fi)
+		}
+	}
+	for _, m := range opts.IncludeMounts {
+		if abs, err := filepath.Abs(m); err == nil {
+			m = abs
+		}
+		if real, err := filepath.EvalSymlinks(m); err == nil {
+			m = real
+		}
+		w.mounts = append(w.mounts, m)
+	}
+	if opts.Previous != nil {
+		w.prev = newPrevious(opts.Previous)
+	}
+	if len(opts.ExcludeCategories) > 0 {
+		w.dropCats = map[string]bool{}
+		for _, c := range opts.ExcludeCategories {
+			w.dropCats[c] = true
+		}
+	}
+	if opts.FollowSymlinks {
+		w.realRoot = root
+		if r, err := realPath(root); err == nil {
+			w.realRoot = r
+		}
+	}
+	return w
+}
+
+// isWithin reports whether p equals root or lies below it.
+func isWithin(p, root string) bool {
+	if p == root {
+		return true
+	}
+	if !strings.HasSuffix(root, string(os.PathSeparator)) {
+		root += string(os.PathSeparator)
+	}
+	return strings.HasPrefix(p, root)
+}
+
+// linkedDir resolves a symlink found during the scan and returns the info of
+// its target if it is a directory the scan is allowed to follow.
+func (w *walker) linkedDir(p string) (os.FileInfo, bool) {
+	ti, err := os.Stat(p)
+	if err != nil || !ti.IsDir() {
+		return nil, false
+	}
+	if !w.opts.FollowExternal {
+		real, err := realPath(p)
+		if err != nil || !isWithin(real, w.realRoot) {
+			return nil, false
+		}
+	}
+	return ti, true
+}
+
+// enter records the identity of dir, or its resolved location where that is
+// not available, and reports false when it was already scanned through
+// another path, which is how symlink and junction cycles end.
+func (w *walker) enter(dir string) bool {
+	var key string
+	if k, ok := dirKey(dir); ok {
+		key = fmt.Sprintf("%d:%d", k.dev, k.ino)
+	} else {
+		real, err := realPath(dir)
+		if err != nil {
+			return true
+		}
+		key = real
+	}
+	w.visitMu.Lock()
+	defer w.visitMu.Unlock()
+	if _, ok := w.visited[key]; ok {
+		return false
+	}
+	w.visited[key] = struct{}{}
+	return true
+}
+
+// crossesDevice reports whether the directory p, described by fi, lives on
+// a different filesystem than the scan root and is not below one of the
+// IncludeMounts. It is always false unless OneFileSystem is set.
+func (w *walker) crossesDevice(p string, fi os.FileInfo) bool {
+	if !w.haveDev {
+		return false
+	}
+	dev, ok := deviceID(fi)
+	if !ok || dev == w.rootDev {
+		return false
+	}
+	if real, err := filepath.EvalSymlinks(p); err == nil {
+		p = real
+	}
+	for _, m := range w.mounts {
+		if isWithin(p, m) {
+			return false
+		}
+	}
+	return true
+}
+
+// fileSize returns the bytes fi accounts for: allocated blocks by default,
+// like du, or the logical length with ApparentSize.
+func (w *walker) fileSize(fi os.FileInfo) int64 {
+	if !w.opts.ApparentSize {
+		if n, ok := allocatedSize(fi); ok {
+			return n
+		}
+	}
+	return fi.Size()
+}
+
+// firstLink reports whether fi is the first link to its inode seen in this
+// scan. Files with a single link and CountLinks bypass the set entirely.
+func (w *walker) firstLink(fi os.FileInfo) bool {
+	if w.opts.CountLinks {
+		return true
+	}
+	key, ok := hardLinkKey(fi)
+	if !ok {
+		return true
+	}
+	w.linkMu.Lock()
+	defer w.linkMu.Unlock()
+	if _, dup := w.seen[key]; dup {
+		return false
+	}
+	w.seen[key] = struct{}{}
+	return true
+}
+
+// classify returns the category of the file at p, falling back to content
+// sniffing for unrecognised files when Sniff is on. Sniffed results are
+// cached per name pattern, so rotated files like "core.1234" and
+// "core.5678" are only read once.
+func (w *walker) classify(p string, fi os.FileInfo) string {
+	c := ClassifyExtension(fi.Name())
+	if c != "Other" || !w.opts.Sniff || fi.Size() < w.opts.SniffMinSize || !fi.Mode().IsRegular() {
+		return c
+	}
+	key := namePattern(fi.Name())
+	w.sniffMu.Lock()
+	cached, ok := w.sniffCache[key]
+	w.sniffMu.Unlock()
+	if !ok {
+		cached = sniffCategory(p)
+		w.sniffMu.Lock()
+		w.sniffCache[key] = cached
+		w.sniffMu.Unlock()
+	}
+	if cached != "Other" {
+		atomic.AddInt64(&w.stats.Sniffed, 1)
+	}
+	return cached
+}
+
+// scanDir reads a single directory and returns its accounting together with
+// the subdirectories to enqueue and those left out as mount points.
+func (w *walker) scanDir(qd queuedDir) dirResult {
+	dir := qd.path
+	fsDir := &FolderSize{Path: dir, FileTypes: map[string]int64{}, TypeCounts: map[string]int64{}}
+	res := dirResult{fs: fsDir}
+	if w.opts.Excludes.Match(dir) {
+		fsDir.skip(SkipExcluded, nil)
+		return res
+	}
+	if w.opts.FollowSymlinks && !w.enter(dir) {
+		fsDir.skip(SkipLoop, nil)
+		return res
+	}
+	mtime := qd.mtime
+	if mtime.IsZero() {
+		if fi, err := os.Stat(dir); err == nil {
+			mtime = fi.ModTime()
+		}
+	}
+	fsDir.DirMtime = mtime
+	if w.reuse(qd, mtime, &res) {
+		return res
+	}
+	if w.opts.CountDirOverhead {
+		if fi, err := os.Lstat(dir); err == nil {
+			fsDir.DirBytes = w.fileSize(fi)
+			fsDir.Total = fsDir.DirBytes
+		}
+	}
+	counted := true
+	if len(w.opts.Includes) > 0 {
+		if !qd.included {
+			if qd.depth == 0 {
+				qd.included = w.includedRoot(dir)
+			} else {
+				qd.included = w.included(dir)
+			}
+		}
+		counted = qd.included
+	}
+	start := time.Now()
+	ents, err := readDir(dir)
+	for try := 0; err != nil && try < w.opts.Retries && retryable(err); try++ {
+		select {
+		case <-w.ctx.Done():
+			try = w.opts.Retries
+			continue
+		case <-time.After(w.opts.RetryDelay << try):
+		}
+		ents, err = readDir(dir)
+	}
+	switch {
+	case err == nil || len(ents) > 0:
+		// Whatever was listed before an error is still counted; the
+		// directory is marked Partial below.
+	case errors.Is(err, os.ErrNotExist):
+		fsDir.skip(SkipVanished, nil)
+		return res
+	case errors.Is(err, os.ErrPermission):
+		fsDir.skip(SkipPermission, err)
+		atomic.AddInt64(&w.stats.Denied, 1)
+		return res
+	default:
+		fsDir.skip(SkipReadError, err)
+		return res
+	}
+	if w.opts.SlowDirThreshold > 0 && time.Since(start) > w.opts.SlowDirThreshold {
+		fsDir.skip(SkipSlowList, nil)
+		return res
+	}
+	var ages [len(AgeBuckets) + 1]int64
+	var churn []string
+	ign := qd.ignore
+	if w.opts.UseGitignore {
+		ign = loadGitignore(dir, ign)
+	}
+	for _, fi := range ents {
+		p := filepath.Join(dir, fi.Name())
+		if fi.IsDir() && isReparsePoint(fi) {
+			// A junction lists as a directory but is a link to another
+			// one: follow it only as a symlink would be.
+			if !w.opts.FollowSymlinks {
+				continue
+			}
+			ti, ok := w.linkedDir(p)
+			if !ok {
+				continue
+			}
+			fi = ti
+		} else if fi.Mode()&os.ModeSymlink != 0 && w.opts.FollowSymlinks {
+			if ti, ok := w.linkedDir(p); ok {
+				fi = ti
+			}
+		}
+		if ign.ignored(p, fi.IsDir()) {
+			continue
+		}
+		if strings.HasPrefix(fi.Name(), ".") && (fi.IsDir() && w.opts.NoHidden || !fi.IsDir() && w.opts.NoHiddenFiles) {
+			continue
+		}
+		if fi.IsDir() {
+			if w.crossesDevice(p, fi) {
+				mnt := &FolderSize{Path: p, FileTypes: map[string]int64{}}
+				mnt.skip(SkipCrossedFS, nil)
+				res.mounts = append(res.mounts, mnt)
+				fsDir.SubdirCount++
+				continue
+			}
+			if !counted && !w.included(p) && !w.mayLead(p) {
+				continue
+			}
+			res.kids = append(res.kids, queuedDir{path: p, depth: qd.depth + 1, ignore: ign, mtime: fi.ModTime(), included: qd.included})
+			fsDir.SubdirCount++
+			continue
+		}
+		if fsDir.Partial || !counted {
+			continue
+		}
+		if !w.opts.Since.IsZero() && fi.ModTime().Before(w.opts.Since) || !w.opts.Until.IsZero() && fi.ModTime().After(w.opts.Until) {
+			continue
+		}
+		var c string
+		if w.dropCats != nil {
+			if c = w.classify(p, fi); w.dropCats[c] {
+				continue
+			}
+		}
+		if w.opts.TrackChurn {
+			churn = append(churn, fmt.Sprintf("%s\x00%d\x00%d", fi.Name(), fi.Size(), fi.ModTime().UnixNano()))
+		}
+		sz := w.fileSize(fi)
+		if w.firstLink(fi) {
+			fsDir.Size += sz
+			if w.opts.TrackLogical {
+				fsDir.Logical += fi.Size()
+			}
+			if c == "" {
+				c = w.classify(p, fi)
+			}
+			fsDir.FileTypes[c] += sz
+			fsDir.TypeCounts[c]++
+			ages[ageBucket(w.now, fi.ModTime())] += sz
+			if w.opts.TopFiles > 0 && sz >= w.opts.MinFileSize {
+				w.offerFile(FileEntry{Path: p, Size: sz, Mtime: fi.ModTime(), Category: c})
+			}
+			if w.opts.FindDupes && fi.Mode().IsRegular() && fi.Size() > 0 && fi.Size() >= w.opts.DupeMinSize {
+				w.addDupeCandidate(p, fi.Size())
+			}
+			if w.opts.PeekArchives && fi.Mode().IsRegular() && fi.Size() >= w.opts.PeekMinSize && archiveKind(fi.Name()) != "" {
+				var deadline time.Time
+				if w.opts.SlowThreshold > 0 {
+					deadline = start.Add(w.opts.SlowThreshold)
+				}
+				a := w.peekArchive(p, sz, deadline)
+				if w.opts.MaxDepth < 0 || qd.depth < w.opts.MaxDepth {
+					// The archive moves out of the directory's own files
+					// into a subdirectory of its own.
+					res.archives = append(res.archives, w.archiveDir(a, fi, sz, c))
+					fsDir.Size -= sz
+					if w.opts.TrackLogical {
+						fsDir.Logical -= fi.Size()
+					}
+					if fsDir.FileTypes[c] -= sz; fsDir.FileTypes[c] == 0 {
+						delete(fsDir.FileTypes, c)
+					}
+					if fsDir.TypeCounts[c]--; fsDir.TypeCounts[c] == 0 {
+						delete(fsDir.TypeCounts, c)
+					}
+					fsDir.SubdirCount++
+					continue
+				}
+			}
+		} else {
+			atomic.AddInt64(&w.stats.LinkedBytes, sz)
+		}
+		fsDir.FileCount++
+		mt := fi.ModTime()
+		if fsDir.Oldest.IsZero() || mt.Before(fsDir.Oldest) {
+			fsDir.Oldest = mt
+		}
+		if mt.After(fsDir.Newest) {
+			fsDir.Newest = mt
+		}
+		if w.opts.SlowThreshold > 0 && time.Since(start) > w.opts.SlowThreshold {
+			fsDir.Partial = true
+			fsDir.SkipReason = SkipSlow
+		}
+	}
+	if err != nil {
+		fsDir.Partial = true
+		if errors.Is(err, os.ErrNotExist) {
+			fsDir.SkipReason = SkipVanished
+		} else {
+			fsDir.SkipReason, fsDir.SkipError = SkipReadError, err.Error()
+		}
+	}
+	for i, n := range ages {
+		if n > 0 {
+			atomic.AddInt64(&w.stats.AgeBytes[i], n)
+		}
+	}
+	if w.opts.TrackChurn && !fsDir.Partial {
+		fsDir.Fingerprint = fingerprint(churn)
+	}
+	fsDir.Total = fsDir.Size + fsDir.DirBytes
+	return res
+}
+
+// readDir lists dir like ioutil.ReadDir, but keeps the entries read
+// before an error instead of dropping them. Entries deleted between being
+// listed and being stat'ed are left out without an error.
+func readDir(dir string) ([]os.FileInfo, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	ents, err := f.Readdir(-1)
+	sort.Slice(ents, func(i, j int) bool { return ents[i].Name() < ents[j].Name() })
+	return ents, err
+}
+
+// fingerprint hashes the file descriptions of one directory independently
+// of the order they were listed in. It sorts files in place.
+func fingerprint(files []string) string {
+	sort.Strings(files)
+	h := sha256.New()
+	for _, f := range files {
+		io.WriteString(h, f)
+		h.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+// Scan walks root and returns the accounting of every directory found,
+// keyed by path. Totals are not rolled up; call AggregateTotals for that.
+// When ctx is cancelled the partial results are returned with ctx.Err().
+func Scan(ctx context.Context, root string, opts Options) (map[string]*FolderSize, error) {
+	m, _, err := ScanStats(ctx, root, opts)
+	return m, err
+}
+
+// ScanStats is Scan that also returns the scan-wide counters.
+func ScanStats(ctx context.Context, root string, opts Options) (map[string]*FolderSize, Stats, error) {
+	if _, err := os.Stat(root); err != nil {
+		return nil, Stats{}, err
+	}
+	prog := opts.Progress
+	workers := opts.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	// A worker that panics stops the others through this context, so the
+	// directories read so far still come back.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var panicErr error
+	var panicOnce sync.Once
+	w := newWalker(root, opts)
+	w.ctx = ctx
+	// Each worker records into its own shard so that the shared lock only
+	// guards the queue; the shards are merged once the walk is over.
+	shards := make([]map[string]*FolderSize, workers)
+	times := make([][]time.Duration, workers)
+	var mu sync.Mutex
+	cond := sync.NewCond(&mu)
+	q := list.New()
+	q.PushBack(queuedDir{path: root})
+	busy := 0
+	stop := context.AfterFunc(ctx, func() {
+		mu.Lock()
+		cond.Broadcast()
+		mu.Unlock()
+	})
+	defer stop()
+	// next blocks until a directory is queued, or returns false once the
+	// queue is drained with no worker left to refill it or ctx is cancelled.
+	next := func() (queuedDir, bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		for q.Len() == 0 && busy > 0 && ctx.Err() == nil {
+			cond.Wait()
+		}
+		if ctx.Err() != nil || q.Len() == 0 {
+			return queuedDir{}, false
+		}
+		e := q.Front()
+		q.Remove(e)
+		busy++
+		return e.Value.(queuedDir), true
+	}
+	var dirCnt, bytesTotal int64
+	var emitMu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		shard := map[string]*FolderSize{}
+		shards[i] = shard
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var dir string
+			defer func() {
+				if r := recover(); r != nil {
+					panicOnce.Do(func() { panicErr = fmt.Errorf("scan failed in %s: %v", dir, r) })
+					cancel()
+				}
+			}()
+			for {
+				qd, ok := next()
+				if !ok {
+					return
+				}
+				dir = qd.path
+				began := time.Now()
+				r := w.scanDir(qd)
+				if opts.TimeDirs {
+					times[i] = append(times[i], time.Since(began))
+				}
+				fsDir := r.fs
+				switch {
+				case opts.Emit != nil:
+					// streamed records are handed off below, not retained
+				case opts.MaxDepth >= 0 && qd.depth > opts.MaxDepth:
+					anc := dir
+					for d := qd.depth; d > opts.MaxDepth; d-- {
+						anc = filepath.Dir(anc)
+					}
+					// the ancestor itself may sit in another shard
+					a := shard[anc]
+					if a == nil {
+						a = &FolderSize{Path: anc, FileTypes: map[string]int64{}}
+						shard[anc] = a
+					}
+					a.Size += fsDir.Size
+					a.Total += fsDir.Total
+					mergeStats(a, fsDir)
+				default:
+					mergeShard(shard, fsDir)
+					if opts.MaxDepth < 0 || qd.depth < opts.MaxDepth {
+						for _, mp := range r.mounts {
+							mergeShard(shard, mp)
+						}
+					}
+					for _, ad := range r.archives {
+						mergeShard(shard, ad)
+					}
+				}
+				mu.Lock()
+				for _, k := range r.kids {
+					q.PushBack(k)
+				}
+				busy--
+				cond.Broadcast()
+				mu.Unlock()
+				if opts.Emit != nil {
+					// unlocked even when Emit panics, or the other
+					// workers would wait for it forever
+					func() {
+						emitMu.Lock()
+						defer emitMu.Unlock()
+						opts.Emit(fsDir)
+						for _, mp := range r.mounts {
+							opts.Emit(mp)
+						}
+						for _, ad := range r.archives {
+							opts.Emit(ad)
+						}
+					}()
+				}
+				read := fsDir.Size
+				for _, ad := range r.archives {
+					read += ad.Size
+				}
+				u := Progress{dir, atomic.AddInt64(&dirCnt, 1), atomic.AddInt64(&bytesTotal, read)}
+				if prog == nil {
+					continue
+				}
+				select {
+				case prog <- u:
+				case <-ctx.Done():
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	for _, t := range times {
+		w.stats.DirTimes = append(w.stats.DirTimes, t...)
+	}
+	res := shards[0]
+	for _, sh := range shards[1:] {
+		for _, fs := range sh {
+			mergeShard(res, fs)
+		}
+	}
+	w.stats.BytesScanned = bytesTotal
+	w.stats.TopFiles = w.topFiles()
+	w.stats.Archives = w.sortedArchives()
+	if opts.FindDupes && ctx.Err() == nil {
+		w.stats.Dupes = w.findDupes(ctx, workers)
+	}
+	if panicErr != nil {
+		return res, w.stats, panicErr
+	}
+	return res, w.stats, ctx.Err()
+}
+
+// mergeShard adds fs to m, combining it with a record for the same path
+// that is already there. That happens when directories folded by MaxDepth
+// were credited to an ancestor scanned by another worker.
+func mergeShard(m map[string]*FolderSize, fs *FolderSize) {
+	dst := m[fs.Path]
+	if dst == nil {
+		m[fs.Path] = fs
+		return
+	}
+	dst.Size += fs.Size
+	dst.Total += fs.Total
+	mergeStats(dst, fs)
+	dst.Skipped = dst.Skipped || fs.Skipped
+	dst.Partial = dst.Partial || fs.Partial
+	if dst.SkipReason == "" {
+		dst.SkipReason, dst.SkipError = fs.SkipReason, fs.SkipError
+	}
+}
+
+// mergeStats folds the file and subdirectory counts, mtime span and type
+// mix of src into dst. Sizes are left to the caller since Size and Total
+// roll up differently.
+func mergeStats(dst, src *FolderSize) {
+	dst.FileCount += src.FileCount
+	dst.SubdirCount += src.SubdirCount
+	dst.DirBytes += src.DirBytes
+	dst.Logical += src.Logical
+	if dst.Oldest.IsZero() || (!src.Oldest.IsZero() && src.Oldest.Before(dst.Oldest)) {
+		dst.Oldest = src.Oldest
+	}
+	if src.Newest.After(dst.Newest) {
+		dst.Newest = src.Newest
+	}
+	for c, s := range src.FileTypes {
+		dst.FileTypes[c] += s
+	}
+	if len(src.TypeCounts) > 0 && dst.TypeCounts == nil {
+		dst.TypeCounts = map[string]int64{}
+	}
+	for c, n := range src.TypeCounts {
+		dst.TypeCounts[c] += n
+	}
+}
@@ -0,0 +1,341 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// scan runs Scan over root with opts and fails the test on an error.
+func scan(t *testing.T, root string, opts Options) map[string]*FolderSize {
+	t.Helper()
+	m, err := Scan(context.Background(), root, opts)
+	if err != nil {
+		t.Fatalf("Scan(%s): %v", root, err)
+	}
+	return m
+}
+
+func TestApparentSizeSparseFile(t *testing.T) {
+	dir := t.TempDir()
+	const size = 64 << 20
+	f, err := os.Create(filepath.Join(dir, "sparse"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Truncate(size); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	opts := DefaultOptions()
+	onDisk := scan(t, dir, opts)[dir].Size
+	opts.ApparentSize = true
+	apparent := scan(t, dir, opts)[dir].Size
+
+	if apparent != size {
+		t.Errorf("apparent size = %d, want %d", apparent, size)
+	}
+	if onDisk == apparent {
+		t.Skip("the filesystem allocated the whole file or does not report blocks")
+	}
+	if onDisk > apparent {
+		t.Errorf("allocated size %d of a sparse file exceeds its length %d", onDisk, apparent)
+	}
+}
+
+func TestSymlinkLoop(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "a"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	loop := filepath.Join(dir, "a", "loop")
+	if err := os.Symlink(dir, loop); err != nil {
+		t.Skipf("cannot create symlinks here: %v", err)
+	}
+	opts := DefaultOptions()
+	opts.FollowSymlinks = true
+	// A walk that goes round the loop never ends; the test gives it ten
+	// seconds.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	m, err := Scan(ctx, dir, opts)
+	if ctx.Err() != nil {
+		t.Fatal("Scan did not finish on a symlink loop")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs := m[loop]
+	if fs == nil || !fs.Skipped || fs.SkipReason != SkipLoop {
+		t.Fatalf("record for %s = %+v, want skipped with %q", loop, fs, SkipLoop)
+	}
+}
+
+// writeTree creates files under dir, keyed by slash-separated path, with
+// the given contents; a key ending in "/" is an empty directory.
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, body := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if strings.HasSuffix(name, "/") {
+			if err := os.MkdirAll(p, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestGitignoreNested(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		".gitignore":       "*.log\n!keep.log\n/top/\n",
+		"a.log":            "x",
+		"keep.log":         "x",
+		"top/f":            "x",
+		"build/f":          "x",
+		"src/.gitignore":   "build/\n",
+		"src/main.go":      "x",
+		"src/build/out.o":  "x",
+		"src/top/f":        "x",
+		"src/debug.log":    "x",
+		"src/lib/build/o":  "x",
+		"src/lib/keep.log": "x",
+	})
+	opts := DefaultOptions()
+	opts.UseGitignore = true
+	m := scan(t, dir, opts)
+
+	for _, c := range []struct {
+		rel  string
+		kept bool
+	}{
+		{"build", true},          // the nested rule only covers src
+		{"top", false},           // "/top/" is anchored to the root
+		{"src/top", true},        // ... so it leaves src/top alone
+		{"src/build", false},     // the nested .gitignore
+		{"src/lib/build", false}, // which holds for the whole subtree
+		{"src/lib", true},
+	} {
+		p := filepath.Join(dir, filepath.FromSlash(c.rel))
+		if (m[p] != nil) != c.kept {
+			t.Errorf("%s: scanned %v, want %v", c.rel, m[p] != nil, c.kept)
+		}
+	}
+	// .gitignore and keep.log, which "!keep.log" brings back; a.log is out.
+	if n := m[dir].FileCount; n != 2 {
+		t.Errorf("root holds %d counted files, want 2", n)
+	}
+	if n := m[filepath.Join(dir, "src")].FileCount; n != 2 {
+		t.Errorf("src holds %d counted files, want 2 (.gitignore, main.go)", n)
+	}
+	if n := m[filepath.Join(dir, "src", "lib")].FileCount; n != 1 {
+		t.Errorf("src/lib holds %d counted files, want 1 (keep.log)", n)
+	}
+}
+
+func TestVanishedDirectory(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"f": "data", "a/f": "data", "gone/f": "data", "kept/f": "data"})
+	gone := filepath.Join(dir, "gone")
+	opts := DefaultOptions()
+	opts.Workers = 1
+	// A single worker reads the root, then a, then gone. It waits on each
+	// progress update, so it is stuck on the one for a while gone is
+	// deleted.
+	prog := make(chan Progress)
+	opts.Progress = prog
+	var m map[string]*FolderSize
+	var err error
+	done := make(chan struct{})
+	go func() {
+		m, err = Scan(context.Background(), dir, opts)
+		close(done)
+	}()
+	<-prog
+	if err := os.RemoveAll(gone); err != nil {
+		t.Fatal(err)
+	}
+	for running := true; running; {
+		select {
+		case <-prog:
+		case <-done:
+			running = false
+		}
+	}
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	if fs := m[gone]; fs == nil || !fs.Skipped || fs.SkipReason != SkipVanished {
+		t.Errorf("record for %s = %+v, want skipped as %q", gone, fs, SkipVanished)
+	}
+	if fs := m[dir]; fs.Skipped || fs.FileCount != 1 {
+		t.Errorf("root record %+v, want its one file counted", fs)
+	}
+	if fs := m[filepath.Join(dir, "kept")]; fs == nil || fs.Skipped || fs.FileCount != 1 {
+		t.Errorf("record for kept = %+v, want its one file counted", fs)
+	}
+}
+
+// TestScanWhileChurning scans a tree that another goroutine keeps adding
+// to and deleting from. Whatever was read must come back without an
+// error, and the only thing wrong with any directory is that it vanished.
+func TestScanWhileChurning(t *testing.T) {
+	dir := t.TempDir()
+	churn := filepath.Join(dir, "churn")
+	writeTree(t, dir, map[string]string{"f": "data", "churn/": ""})
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			d := filepath.Join(churn, fmt.Sprintf("d%d", i%8))
+			if i%3 == 0 {
+				os.RemoveAll(d)
+				continue
+			}
+			os.MkdirAll(filepath.Join(d, "sub"), 0o755)
+			os.WriteFile(filepath.Join(d, fmt.Sprintf("f%d", i)), []byte("data"), 0o644)
+			os.WriteFile(filepath.Join(d, "sub", "f"), []byte("data"), 0o644)
+		}
+	}()
+	defer func() {
+		close(stop)
+		wg.Wait()
+	}()
+	opts := DefaultOptions()
+	opts.Workers = 4
+	for i := 0; i < 50; i++ {
+		m := scan(t, dir, opts)
+		if fs := m[dir]; fs.Skipped || fs.Partial || fs.FileCount != 1 {
+			t.Fatalf("root record %+v, want its one file counted", fs)
+		}
+		for p, fs := range m {
+			if fs.SkipReason != "" && fs.SkipReason != SkipVanished {
+				t.Fatalf("%s: %s %s", p, fs.SkipReason, fs.SkipError)
+			}
+		}
+	}
+}
+
+func TestEmitPanic(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{}
+	for i := 0; i < 50; i++ {
+		files[fmt.Sprintf("d%d/f", i)] = "data"
+	}
+	writeTree(t, dir, files)
+	opts := DefaultOptions()
+	opts.Workers = 4
+	var mu sync.Mutex
+	emitted := 0
+	opts.Emit = func(fs *FolderSize) {
+		mu.Lock()
+		defer mu.Unlock()
+		if emitted++; emitted == 3 {
+			// give the other workers time to queue up behind this call
+			time.Sleep(50 * time.Millisecond)
+			panic("encoder broke")
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := Scan(ctx, dir, opts)
+	if ctx.Err() != nil {
+		t.Fatal("Scan did not finish after Emit panicked")
+	}
+	if err == nil || !strings.Contains(err.Error(), "encoder broke") {
+		t.Errorf("Scan returned %v, want the panic as an error", err)
+	}
+}
+
+func TestMergeShard(t *testing.T) {
+	old := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	mid := old.AddDate(1, 0, 0)
+	late := old.AddDate(2, 0, 0)
+	m := map[string]*FolderSize{}
+	mergeShard(m, &FolderSize{Path: "/a", Size: 10, Total: 10, FileCount: 1, Oldest: mid, Newest: mid,
+		FileTypes: map[string]int64{"Logs": 10}, TypeCounts: map[string]int64{"Logs": 1}})
+	mergeShard(m, &FolderSize{Path: "/a", Size: 5, Total: 5, FileCount: 2, Oldest: old, Newest: late,
+		FileTypes: map[string]int64{"Logs": 2, "Video": 3}, TypeCounts: map[string]int64{"Logs": 1, "Video": 1},
+		Partial: true})
+	a := m["/a"]
+	if a.Size != 15 || a.Total != 15 || a.FileCount != 3 || !a.Partial {
+		t.Errorf("merged %+v", a)
+	}
+	if a.FileTypes["Logs"] != 12 || a.FileTypes["Video"] != 3 || a.TypeCounts["Logs"] != 2 || a.TypeCounts["Video"] != 1 {
+		t.Errorf("merged types %v, counts %v", a.FileTypes, a.TypeCounts)
+	}
+	if !a.Oldest.Equal(old) || !a.Newest.Equal(late) {
+		t.Errorf("merged mtimes %v – %v, want %v – %v", a.Oldest, a.Newest, old, late)
+	}
+}
+
+// benchRecords has each of workers goroutines produce its share of n
+// directory records and hand them to record.
+func benchRecords(workers, n int, record func(w int, fs *FolderSize)) {
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < n; i += workers {
+				record(w, &FolderSize{Path: fmt.Sprintf("/data/d%d", i), Size: int64(i), Total: int64(i),
+					FileCount: 1, FileTypes: map[string]int64{"Other": int64(i)}})
+			}
+		}(w)
+	}
+	wg.Wait()
+}
+
+// BenchmarkResults compares recording scan results into a map per worker,
+// merged at the end as ScanStats does, with one map behind a mutex.
+func BenchmarkResults(b *testing.B) {
+	const n = 100000
+	workers := 4 * runtime.GOMAXPROCS(0)
+	b.Run("sharded", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			shards := make([]map[string]*FolderSize, workers)
+			for w := range shards {
+				shards[w] = map[string]*FolderSize{}
+			}
+			benchRecords(workers, n, func(w int, fs *FolderSize) { mergeShard(shards[w], fs) })
+			res := shards[0]
+			for _, sh := range shards[1:] {
+				for _, fs := range sh {
+					mergeShard(res, fs)
+				}
+			}
+		}
+	})
+	b.Run("locked", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			var mu sync.Mutex
+			res := map[string]*FolderSize{}
+			benchRecords(workers, n, func(_ int, fs *FolderSize) {
+				mu.Lock()
+				mergeShard(res, fs)
+				mu.Unlock()
+			})
+		}
+	})
+}
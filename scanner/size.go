@@ -0,0 +1,54 @@
+package scanner
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var sizeRe = regexp.MustCompile(`^([0-9]*\.?[0-9]+)\s*([A-Za-z]*)$`)
+
+// ParseSize parses sizes like "100G", "1.5TiB", "512KB" or "1000000" into
+// bytes using binary multiples throughout.
+func ParseSize(s string) (int64, error) {
+	return ParseSizeUnits(s, false)
+}
+
+// ParseSizeUnits parses a size into bytes. A bare number is bytes, a
+// single letter such as "G" and the IEC forms such as "GiB" are always
+// 1024-based, and "kB", "MB", "GB"… are 1000-based when decimal is set
+// and 1024-based otherwise. Case does not matter.
+func ParseSizeUnits(s string, decimal bool) (int64, error) {
+	m := sizeRe.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return 0, fmt.Errorf("bad size %q", s)
+	}
+	v, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("bad size %q", s)
+	}
+	mult := 1.0
+	switch unit := strings.ToLower(m[2]); unit {
+	case "", "b":
+	default:
+		exp := strings.IndexByte("kmgtp", unit[0]) + 1
+		switch {
+		case exp == 0:
+			return 0, fmt.Errorf("unknown unit %q in %q (want B, K, KiB, KB up to P, PiB, PB)", m[2], s)
+		case unit[1:] == "" || unit[1:] == "ib":
+			mult = math.Pow(1024, float64(exp))
+		case unit[1:] == "b" && decimal:
+			mult = math.Pow(1000, float64(exp))
+		case unit[1:] == "b":
+			mult = math.Pow(1024, float64(exp))
+		default:
+			return 0, fmt.Errorf("unknown unit %q in %q (want B, K, KiB, KB up to P, PiB, PB)", m[2], s)
+		}
+	}
+	if v*mult >= math.MaxInt64 {
+		return 0, fmt.Errorf("size %q is too large", s)
+	}
+	return int64(v * mult), nil
+}
@@ -0,0 +1,33 @@
+package scanner
+
+import "testing"
+
+func TestParseSizeUnits(t *testing.T) {
+	for _, c := range []struct {
+		in      string
+		decimal bool
+		want    int64
+	}{
+		{"1000000", false, 1000000},
+		{"512", true, 512},
+		{"1.5G", false, 1536 << 20},
+		{"1.5G", true, 1536 << 20},
+		{"1536MiB", false, 1536 << 20},
+		{"1536MiB", true, 1536 << 20},
+		{"1.5GB", false, 1536 << 20},
+		{"1.5GB", true, 1500000000},
+		{"100 kb", true, 100000},
+		{"2TiB", false, 2 << 40},
+		{"10B", false, 10},
+	} {
+		got, err := ParseSizeUnits(c.in, c.decimal)
+		if err != nil || got != c.want {
+			t.Errorf("ParseSizeUnits(%q, %v) = %d, %v; want %d", c.in, c.decimal, got, err, c.want)
+		}
+	}
+	for _, in := range []string{"10XB", "", "-1", "1.5.5K", "G", "1GiBs", "12 34"} {
+		if got, err := ParseSizeUnits(in, false); err == nil {
+			t.Errorf("ParseSizeUnits(%q) = %d, want an error", in, got)
+		}
+	}
+}
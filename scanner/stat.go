@@ -0,0 +1,7 @@
+package scanner
+
+// fileKey identifies a file independently of the path it was reached by.
+type fileKey struct {
+	dev uint64
+	ino uint64
+}
@@ -0,0 +1,16 @@
+//go:build !unix
+
+package scanner
+
+import "os"
+
+// deviceID is unavailable on this platform, so filesystem boundaries are
+// never detected and --one-file-system has no effect.
+func deviceID(fi os.FileInfo) (uint64, bool) { return 0, false }
+
+// allocatedSize is unavailable on this platform; callers fall back to the
+// logical file size.
+func allocatedSize(fi os.FileInfo) (int64, bool) { return 0, false }
+
+// hardLinkKey is unavailable on this platform, so every link is counted.
+func hardLinkKey(fi os.FileInfo) (fileKey, bool) { return fileKey{}, false }
@@ -0,0 +1,38 @@
+//go:build unix
+
+package scanner
+
+import (
+	"os"
+	"syscall"
+)
+
+// deviceID returns the st_dev of the file described by fi.
+func deviceID(fi os.FileInfo) (uint64, bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return uint64(st.Dev), true
+}
+
+// allocatedSize returns the bytes actually allocated on disk for fi.
+// st_blocks is always counted in 512-byte units regardless of the
+// filesystem block size.
+func allocatedSize(fi os.FileInfo) (int64, bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return int64(st.Blocks) * 512, true
+}
+
+// hardLinkKey identifies the inode behind fi. It only reports files with
+// more than one link, since only those can be counted twice.
+func hardLinkKey(fi os.FileInfo) (fileKey, bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok || st.Nlink < 2 {
+		return fileKey{}, false
+	}
+	return fileKey{dev: uint64(st.Dev), ino: uint64(st.Ino)}, true
+}
@@ -0,0 +1,71 @@
+package scanner
+
+import (
+	"container/heap"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// FileEntry is one of the largest files found by a scan.
+type FileEntry struct {
+	Path     string    `json:"path"`
+	Size     int64     `json:"size_bytes"`
+	Mtime    time.Time `json:"mtime"`
+	Category string    `json:"category"`
+}
+
+// StatFile describes the single file at p as a scan with opts would count
+// it. It fails for directories.
+func StatFile(p string, opts Options) (FileEntry, error) {
+	fi, err := os.Stat(p)
+	if err != nil {
+		return FileEntry{}, err
+	}
+	if fi.IsDir() {
+		return FileEntry{}, fmt.Errorf("%s is a directory", p)
+	}
+	w := newWalker(p, opts)
+	return FileEntry{Path: p, Size: w.fileSize(fi), Mtime: fi.ModTime(), Category: w.classify(p, fi)}, nil
+}
+
+// fileHeap is a min-heap on Size, so the smallest of the kept files is the
+// one to drop when a larger one turns up.
+type fileHeap []FileEntry
+
+func (h fileHeap) Len() int            { return len(h) }
+func (h fileHeap) Less(i, j int) bool  { return h[i].Size < h[j].Size }
+func (h fileHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *fileHeap) Push(x interface{}) { *h = append(*h, x.(FileEntry)) }
+func (h *fileHeap) Pop() interface{} {
+	old := *h
+	e := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return e
+}
+
+// offerFile keeps f if it is among the TopFiles largest seen so far.
+func (w *walker) offerFile(f FileEntry) {
+	w.topMu.Lock()
+	defer w.topMu.Unlock()
+	switch {
+	case len(w.top) < w.opts.TopFiles:
+		heap.Push(&w.top, f)
+	case f.Size > w.top[0].Size:
+		w.top[0] = f
+		heap.Fix(&w.top, 0)
+	}
+}
+
+// topFiles returns the kept files, largest first.
+func (w *walker) topFiles() []FileEntry {
+	out := append([]FileEntry(nil), w.top...)
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Size != out[j].Size {
+			return out[i].Size > out[j].Size
+		}
+		return out[i].Path < out[j].Path
+	})
+	return out
+}
@@ -84,7 +84,7 @@ func main() {
 			outputPath := filepath.Join(outputDir, execFileName)
 
 			ldflags := fmt.Sprintf("-X main.version=%s", version)
-			buildCmd := exec.Command("go", "build", "-ldflags", ldflags, "-o", outputPath, goSourceFile)
+			buildCmd := exec.Command("go", "build", "-ldflags", ldflags, "-o", outputPath, ".")
 			buildCmd.Env = append(os.Environ(), "GOOS="+osName, "GOARCH="+arch)
 			if err := buildCmd.Run(); err != nil {
 				// Remove the directory if build fails
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"find-large-dirs/scanner"
+)
+
+// snapshotPath places named snapshots next to the history db so that
+// --db also moves them; they are compressed when the db is.
+func snapshotPath(db, name string) (string, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return "", fmt.Errorf("invalid snapshot name %q", name)
+	}
+	file := name + ".json"
+	if gzipped(db) {
+		file += ".gz"
+	}
+	return filepath.Join(filepath.Dir(db), "snapshots", file), nil
+}
+
+func loadSnapshot(db, name string) (map[string]*scanner.FolderSize, time.Time, error) {
+	p, err := snapshotPath(db, name)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if _, err := os.Stat(p); err != nil {
+		return nil, time.Time{}, fmt.Errorf("snapshot %q: %w", name, err)
+	}
+	m, hdr := loadPrev(p)
+	ts := hdr.Timestamp
+	if ts.IsZero() {
+		return nil, time.Time{}, fmt.Errorf("snapshot %q: %s is not a find-large-dirs db", name, p)
+	}
+	return m, ts, nil
+}
+
+type dirChange struct {
+	Path     string
+	Old, New int64
+	Status   string
+}
+
+// diffSnapshots lists every directory whose total differs between a and b,
+// largest absolute change first, followed by those that kept their total
+// while the files directly inside changed, when both carry fingerprints.
+func diffSnapshots(a, b map[string]*scanner.FolderSize) []dirChange {
+	var out []dirChange
+	for p, o := range a {
+		n, ok := b[p]
+		switch {
+		case !ok:
+			out = append(out, dirChange{p, o.Total, 0, "removed"})
+		case n.Total > o.Total:
+			out = append(out, dirChange{p, o.Total, n.Total, "grown"})
+		case n.Total < o.Total:
+			out = append(out, dirChange{p, o.Total, n.Total, "shrunk"})
+		case o.Fingerprint != "" && n.Fingerprint != "" && o.Fingerprint != n.Fingerprint:
+			out = append(out, dirChange{p, o.Total, n.Total, "churned"})
+		}
+	}
+	for p, n := range b {
+		if _, ok := a[p]; !ok {
+			out = append(out, dirChange{p, 0, n.Total, "added"})
+		}
+	}
+	abs := func(d int64) int64 {
+		if d < 0 {
+			return -d
+		}
+		return d
+	}
+	sort.Slice(out, func(i, j int) bool {
+		di, dj := abs(out[i].New-out[i].Old), abs(out[j].New-out[j].Old)
+		if di != dj {
+			return di > dj
+		}
+		return out[i].Path < out[j].Path
+	})
+	return out
+}
+
+// compareSnapshots prints the diff between two named snapshots, limited to
+// the top largest changes.
+func compareSnapshots(db, nameA, nameB string, top int) error {
+	a, ta, err := loadSnapshot(db, nameA)
+	if err != nil {
+		return err
+	}
+	b, tb, err := loadSnapshot(db, nameB)
+	if err != nil {
+		return err
+	}
+	changes := diffSnapshots(a, b)
+	fmt.Fprintf(stdout, "Comparing %s%s%s (%s) → %s%s%s (%s)\n\n",
+		color(Bold), nameA, color(ColorReset), ta.Format("2006-01-02 15:04"),
+		color(Bold), nameB, color(ColorReset), tb.Format("2006-01-02 15:04"))
+	if len(changes) == 0 {
+		fmt.Fprintln(stdout, "No differences.")
+		return nil
+	}
+	if top > 0 && len(changes) > top {
+		changes = changes[:top]
+	}
+	for _, c := range changes {
+		col := ColorRed
+		if c.New < c.Old {
+			col = ColorGreen
+		} else if c.Status == "churned" {
+			col = ColorYellow
+		}
+		fmt.Fprintf(stdout, "%s%-8s%s %12s  %s  (%s → %s)\n", color(col), c.Status, color(ColorReset),
+			signedSize(c.New-c.Old), c.Path, formatSize(c.Old), formatSize(c.New))
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"container/heap"
+
+	"find-large-dirs/scanner"
+)
+
+// sizeHeap is a min-heap on the bytes directly inside a directory, so the
+// smallest of the kept ones is the one to drop when a larger one turns up.
+type sizeHeap []*scanner.FolderSize
+
+func (h sizeHeap) Len() int            { return len(h) }
+func (h sizeHeap) Less(i, j int) bool  { return h[i].Size < h[j].Size }
+func (h sizeHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *sizeHeap) Push(x interface{}) { *h = append(*h, x.(*scanner.FolderSize)) }
+func (h *sizeHeap) Pop() interface{} {
+	old := *h
+	fs := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return fs
+}
+
+// streamCollector backs --streaming: it receives every directory through
+// scanner.Options.Emit and keeps only the n with the most bytes directly
+// inside, plus running totals for the whole scan, so memory stays flat
+// however many directories there are. Nothing is rolled up into parents.
+type streamCollector struct {
+	n      int
+	top    sizeHeap
+	total  *scanner.FolderSize
+	counts *Summary
+	failed bool // a directory could not be read
+}
+
+func newStreamCollector(root string, n int) *streamCollector {
+	return &streamCollector{
+		n:      n,
+		total:  &scanner.FolderSize{Path: root, FileTypes: map[string]int64{}, TypeCounts: map[string]int64{}},
+		counts: newSummary(root),
+	}
+}
+
+// add takes one directory record. The scanner serialises the calls.
+func (c *streamCollector) add(fs *scanner.FolderSize) {
+	if fs.SkipReason == scanner.SkipPermission || fs.SkipReason == scanner.SkipReadError {
+		c.failed = true
+	}
+	c.counts.count(fs)
+	c.total.Total += fs.Total
+	c.total.DirBytes += fs.DirBytes
+	c.total.FileCount += fs.FileCount
+	for k, v := range fs.FileTypes {
+		c.total.FileTypes[k] += v
+	}
+	for k, v := range fs.TypeCounts {
+		c.total.TypeCounts[k] += v
+	}
+	if fs.Size == 0 {
+		return
+	}
+	if len(c.top) < c.n {
+		heap.Push(&c.top, fs)
+	} else if c.n > 0 && fs.Size > c.top[0].Size {
+		c.top[0] = fs
+		heap.Fix(&c.top, 0)
+	}
+}
+
+// result returns the kept directories keyed by path.
+func (c *streamCollector) result() map[string]*scanner.FolderSize {
+	m := make(map[string]*scanner.FolderSize, len(c.top))
+	for _, fs := range c.top {
+		m[fs.Path] = fs
+	}
+	return m
+}
+
+// summary returns the running totals as a one-record map, the shape
+// printTypeSummary expects.
+func (c *streamCollector) summary() map[string]*scanner.FolderSize {
+	return map[string]*scanner.FolderSize{c.total.Path: c.total}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"find-large-dirs/scanner"
+)
+
+func TestStreamCollectorKeepsLargest(t *testing.T) {
+	c := newStreamCollector("/data", 3)
+	for i := 1; i <= 10; i++ {
+		c.add(&scanner.FolderSize{Path: fmt.Sprintf("/data/d%d", i), Size: int64(i), Total: int64(i), FileCount: 1,
+			FileTypes: map[string]int64{"Other": int64(i)}})
+	}
+	m := c.result()
+	if len(m) != 3 {
+		t.Fatalf("kept %d directories, want 3", len(m))
+	}
+	for _, p := range []string{"/data/d8", "/data/d9", "/data/d10"} {
+		if m[p] == nil {
+			t.Errorf("%s was dropped", p)
+		}
+	}
+	if c.total.Total != 55 || c.total.FileCount != 10 || c.total.FileTypes["Other"] != 55 {
+		t.Errorf("running totals %+v", c.total)
+	}
+}
+
+// makeTree creates fan[0] directories below dir, fan[1] below each of
+// those and so on, with one small file in every directory.
+func makeTree(b *testing.B, dir string, fan []int) {
+	if err := os.WriteFile(filepath.Join(dir, "f"), []byte("data"), 0o644); err != nil {
+		b.Fatal(err)
+	}
+	if len(fan) == 0 {
+		return
+	}
+	for i := 0; i < fan[0]; i++ {
+		sub := filepath.Join(dir, fmt.Sprintf("d%d", i))
+		if err := os.Mkdir(sub, 0o755); err != nil {
+			b.Fatal(err)
+		}
+		makeTree(b, sub, fan[1:])
+	}
+}
+
+// BenchmarkStreaming scans ever larger trees keeping every record, as a
+// plain scan does, and through streamCollector, as --streaming does, and
+// reports the live heap once each scan is over. The heap grows with the
+// tree for the first and stays about the same for the second.
+func BenchmarkStreaming(b *testing.B) {
+	for _, fan := range [][]int{{10, 10, 10}, {20, 20, 20}, {30, 30, 30}} {
+		root := b.TempDir()
+		makeTree(b, root, fan)
+		dirs := 1
+		for n := 1; len(fan) > 0; fan = fan[1:] {
+			n *= fan[0]
+			dirs += n
+		}
+		opts := scanner.DefaultOptions()
+		for _, streaming := range []bool{false, true} {
+			name := fmt.Sprintf("%ddirs/retained", dirs)
+			if streaming {
+				name = fmt.Sprintf("%ddirs/streaming", dirs)
+			}
+			b.Run(name, func(b *testing.B) {
+				b.ReportAllocs()
+				var heap uint64
+				for i := 0; i < b.N; i++ {
+					o := opts
+					var stream *streamCollector
+					if streaming {
+						stream = newStreamCollector(root, 20)
+						o.Emit = stream.add
+					}
+					m, _, err := scanner.ScanStats(context.Background(), root, o)
+					if err != nil {
+						b.Fatal(err)
+					}
+					b.StopTimer()
+					var ms runtime.MemStats
+					runtime.GC()
+					runtime.ReadMemStats(&ms)
+					heap = ms.HeapAlloc
+					runtime.KeepAlive(m)
+					runtime.KeepAlive(stream)
+					b.StartTimer()
+				}
+				b.ReportMetric(float64(heap), "heap-B")
+			})
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+
+	"find-large-dirs/scanner"
+)
+
+// Summary holds the headline numbers of a scan for --summary, so that a
+// dashboard need not add up the directory records itself.
+type Summary struct {
+	// Type is "summary" on the last line of --ndjson output, to tell it
+	// from the directory records.
+	Type        string    `json:"type,omitempty"`
+	Root        string    `json:"root"`
+	Timestamp   time.Time `json:"timestamp"`
+	Bytes       int64     `json:"total_bytes"`
+	Files       int64     `json:"file_count"`
+	Dirs        int64     `json:"dirs_scanned"`
+	ScanSeconds float64   `json:"scan_seconds"`
+	Partial     bool      `json:"partial,omitempty"`
+	// Skipped and PartialDirs count the directories left out or read
+	// only in part, by SkipReason.
+	Skipped     map[string]int64 `json:"dirs_skipped"`
+	PartialDirs map[string]int64 `json:"dirs_partial,omitempty"`
+	DiskTotal   int64            `json:"disk_total_bytes,omitempty"`
+	DiskUsed    int64            `json:"disk_used_bytes,omitempty"`
+	DiskFree    int64            `json:"disk_free_bytes,omitempty"`
+}
+
+func newSummary(root string) *Summary {
+	s := &Summary{Root: root, Timestamp: zone(time.Now()), Skipped: map[string]int64{}, PartialDirs: map[string]int64{}}
+	if d, err := scanner.DiskUsage(root); err == nil {
+		s.DiskTotal, s.DiskUsed, s.DiskFree = d.Total, d.Used, d.Free
+	}
+	return s
+}
+
+// count notes one directory record in the directory counts.
+func (s *Summary) count(fs *scanner.FolderSize) {
+	switch {
+	case fs.Skipped:
+		s.Skipped[fs.SkipReason]++
+	case fs.Partial:
+		s.PartialDirs[fs.SkipReason]++
+		s.Dirs++
+	default:
+		s.Dirs++
+	}
+}
+
+// summarize builds the summary of m once AggregateTotals has run on it.
+func summarize(m map[string]*scanner.FolderSize, root string, took time.Duration, partial bool) *Summary {
+	s := newSummary(root)
+	for _, fs := range m {
+		s.count(fs)
+	}
+	if fs := m[root]; fs != nil {
+		s.Bytes, s.Files = fs.Total, fs.FileCount
+	}
+	s.ScanSeconds, s.Partial = took.Seconds(), partial
+	return s
+}
+
+// writeJSONSummary is writeJSON with the summary alongside: one object
+// holding the directories under "dirs" and the summary under "summary".
+func writeJSONSummary(w io.Writer, dirs []*scanner.FolderSize, s *Summary) error {
+	out := make([]*scanner.FolderSize, len(dirs))
+	for i, fs := range dirs {
+		out[i] = zoned(fs)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		Dirs    []*scanner.FolderSize `json:"dirs"`
+		Summary *Summary              `json:"summary"`
+	}{out, s})
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// palette maps the base colors to what the active theme draws instead; a
+// color missing from it is drawn as is. color consults it, so every
+// colored piece of output follows the theme.
+var palette map[string]string
+
+// sizeMarkers adds ▲ and ▲▲ after sizes colored as warning and critical,
+// so the severity does not depend on telling the hues apart.
+var sizeMarkers bool
+
+// themes are the palettes --theme chooses from. The colorblind one uses
+// the Okabe–Ito hues, which stay apart with every common form of color
+// blindness; mono keeps only bold and inverse video.
+var themes = map[string]map[string]string{
+	"default": nil,
+	"colorblind": {
+		ColorRed:     "\033[38;5;166m", // vermillion
+		ColorGreen:   "\033[38;5;74m",  // sky blue
+		ColorYellow:  "\033[38;5;220m", // yellow
+		ColorBlue:    "\033[38;5;25m",  // blue
+		ColorMagenta: "\033[38;5;175m", // reddish purple
+		ColorCyan:    "\033[38;5;36m",  // bluish green
+	},
+	"mono": {
+		ColorRed:     "",
+		ColorGreen:   "",
+		ColorYellow:  "",
+		ColorBlue:    "",
+		ColorMagenta: "",
+		ColorCyan:    "",
+	},
+}
+
+// setTheme activates the named theme.
+func setTheme(name string) error {
+	p, ok := themes[name]
+	if !ok {
+		return fmt.Errorf("unknown theme %q (want default, colorblind or mono)", name)
+	}
+	palette = p
+	sizeMarkers = name == "colorblind"
+	return nil
+}
+
+// loadThemeConfig reads a JSON object mapping category names to colors,
+// e.g. {"Video": "magenta", "Log": "208"}, and applies it like
+// --add-category.
+func loadThemeConfig(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var cfg map[string]string
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	for name, col := range cfg {
+		if err := parseCategoryColor(name + "=" + col); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	return nil
+}
+
+// sizeMarker returns the severity marker for a size colored c, or "".
+func sizeMarker(c string) string {
+	if !sizeMarkers || !useColor {
+		return ""
+	}
+	switch c {
+	case ColorRed:
+		return " ▲▲"
+	case ColorYellow:
+		return " ▲"
+	}
+	return ""
+}
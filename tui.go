@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"find-large-dirs/scanner"
+)
+
+// browseSteps are the --min-size values the interactive view cycles
+// through with + and -.
+var browseSteps = []int64{0, 1 << 20, 10 << 20, 100 << 20, 1 << 30, 10 << 30, 100 << 30, 1 << 40}
+
+var browseSorts = []string{"size", "count", "age", "name"}
+
+// browser is the state of the --interactive view.
+type browser struct {
+	all     map[string]*scanner.FolderSize
+	kids    map[string][]*scanner.FolderSize
+	root    string
+	cwd     string
+	cursor  int
+	offset  int
+	sortIdx int
+	reverse bool
+	minIdx  int
+	rows    int
+	cols    int
+	entries []*scanner.FolderSize
+}
+
+// browse runs an ncdu-style view over the scan results until the user
+// quits. Arrow keys move and descend, Backspace goes up, s cycles the sort
+// order, r reverses it, +/- change the size filter and q quits.
+func browse(root string, all map[string]*scanner.FolderSize, sortKey string, reverse bool) error {
+	if all[root] == nil {
+		return fmt.Errorf("no results for %s", root)
+	}
+	restore, err := rawTerminal()
+	if err != nil {
+		return err
+	}
+	fmt.Print("\033[?1049h\033[?25l")
+	defer func() {
+		fmt.Print("\033[?25h\033[?1049l")
+		restore()
+	}()
+	b := &browser{all: all, root: root, cwd: root, reverse: reverse, kids: map[string][]*scanner.FolderSize{}}
+	for i, k := range browseSorts {
+		if k == sortKey {
+			b.sortIdx = i
+		}
+	}
+	for p, fs := range all {
+		if par := filepath.Dir(p); par != p {
+			b.kids[par] = append(b.kids[par], fs)
+		}
+	}
+	in := bufio.NewReader(os.Stdin)
+	for {
+		b.rows, b.cols = terminalSize()
+		b.refresh()
+		b.draw()
+		key, err := readKey(in)
+		if err != nil {
+			return err
+		}
+		switch key {
+		case "q", "\x03":
+			return nil
+		case "up", "k":
+			b.cursor--
+		case "down", "j":
+			b.cursor++
+		case "right", "enter", "l":
+			if b.cursor < len(b.entries) && len(b.kids[b.entries[b.cursor].Path]) > 0 {
+				b.cwd = b.entries[b.cursor].Path
+				b.cursor, b.offset = 0, 0
+			}
+		case "left", "backspace", "h":
+			if b.cwd != b.root {
+				prev := b.cwd
+				b.cwd = filepath.Dir(b.cwd)
+				b.refresh()
+				for i, e := range b.entries {
+					if e.Path == prev {
+						b.cursor = i
+					}
+				}
+			}
+		case "s":
+			b.sortIdx = (b.sortIdx + 1) % len(browseSorts)
+		case "r":
+			b.reverse = !b.reverse
+		case "+":
+			if b.minIdx < len(browseSteps)-1 {
+				b.minIdx++
+			}
+		case "-":
+			if b.minIdx > 0 {
+				b.minIdx--
+			}
+		}
+	}
+}
+
+// refresh recomputes the visible entries of cwd and clamps the cursor.
+func (b *browser) refresh() {
+	less, _ := folderLess(browseSorts[b.sortIdx], b.reverse)
+	b.entries = b.entries[:0]
+	for _, k := range b.kids[b.cwd] {
+		if k.Total >= browseSteps[b.minIdx] {
+			b.entries = append(b.entries, k)
+		}
+	}
+	sort.Slice(b.entries, func(i, j int) bool { return less(b.entries[i], b.entries[j]) })
+	if b.cursor >= len(b.entries) {
+		b.cursor = len(b.entries) - 1
+	}
+	if b.cursor < 0 {
+		b.cursor = 0
+	}
+	height := b.rows - 4
+	if height < 1 {
+		height = 1
+	}
+	if b.cursor < b.offset {
+		b.offset = b.cursor
+	}
+	if b.cursor >= b.offset+height {
+		b.offset = b.cursor - height + 1
+	}
+}
+
+func (b *browser) draw() {
+	cur := b.all[b.cwd]
+	var sb strings.Builder
+	sb.WriteString("\033[H\033[2J")
+	fmt.Fprintf(&sb, "%s%s%s  %s  (%d files)\r\n", color(Bold), shortenPath(b.cwd, max(b.cols-30, 10)), color(ColorReset), formatSize(cur.Total), cur.FileCount)
+	fmt.Fprintf(&sb, "sort: %s", browseSorts[b.sortIdx])
+	if b.reverse {
+		sb.WriteString(" (reversed)")
+	}
+	fmt.Fprintf(&sb, "   min-size: %s   [↑↓ move, → open, ← up, s sort, r reverse, +/- filter, q quit]\r\n\r\n", formatSize(browseSteps[b.minIdx]))
+	height := b.rows - 4
+	for i := b.offset; i < len(b.entries) && i < b.offset+height; i++ {
+		e := b.entries[i]
+		pct := 0.0
+		if cur.Total > 0 {
+			pct = float64(e.Total) * 100 / float64(cur.Total)
+		}
+		var mix []string
+		for j, t := range typeShares(e.FileTypes) {
+			if j == 2 || e.Total == 0 {
+				break
+			}
+			mix = append(mix, fmt.Sprintf("%.0f%% %s", float64(t.S)*100/float64(e.Total), t.C))
+		}
+		name := filepath.Base(e.Path)
+		if len(b.kids[e.Path]) > 0 {
+			name += "/"
+		}
+		line := fmt.Sprintf("%10s %6.1f%%  %s %s", formatSize(e.Total), pct, padRight(shortenPath(name, 40), 40), strings.Join(mix, ", "))
+		line = truncateRight(line, max(b.cols-1, 10))
+		if i == b.cursor {
+			line = "\033[7m" + line + "\033[0m"
+		}
+		sb.WriteString(line + "\r\n")
+	}
+	if len(b.entries) == 0 {
+		sb.WriteString("   (no subdirectories above the size filter)\r\n")
+	}
+	fmt.Print(sb.String())
+}
+
+// readKey reads one key press, folding escape sequences into names.
+func readKey(in *bufio.Reader) (string, error) {
+	c, err := in.ReadByte()
+	if err != nil {
+		return "", err
+	}
+	switch c {
+	case '\r', '\n':
+		return "enter", nil
+	case 127, 8:
+		return "backspace", nil
+	case 27:
+		if in.Buffered() == 0 {
+			return "q", nil
+		}
+		if c2, _ := in.ReadByte(); c2 != '[' && c2 != 'O' {
+			return "", nil
+		}
+		c3, _ := in.ReadByte()
+		switch c3 {
+		case 'A':
+			return "up", nil
+		case 'B':
+			return "down", nil
+		case 'C':
+			return "right", nil
+		case 'D':
+			return "left", nil
+		}
+		return "", nil
+	}
+	return string(c), nil
+}
+
+// rawTerminal switches stdin to raw mode with stty and returns a function
+// restoring the previous settings.
+func rawTerminal() (func(), error) {
+	if !isTerminal(os.Stdin) || !isTerminal(os.Stdout) {
+		return nil, fmt.Errorf("stdin and stdout must be a terminal")
+	}
+	saved, err := stty("-g")
+	if err != nil {
+		return nil, fmt.Errorf("cannot control the terminal: %w", err)
+	}
+	if _, err := stty("raw", "-echo"); err != nil {
+		return nil, err
+	}
+	return func() { stty(strings.TrimSpace(saved)) }, nil
+}
+
+// terminalSize returns the terminal rows and columns, defaulting to 24x80.
+func terminalSize() (int, int) {
+	out, err := stty("size")
+	if err != nil {
+		return 24, 80
+	}
+	f := strings.Fields(out)
+	if len(f) != 2 {
+		return 24, 80
+	}
+	r, err1 := strconv.Atoi(f[0])
+	c, err2 := strconv.Atoi(f[1])
+	if err1 != nil || err2 != nil || r == 0 || c == 0 {
+		return 24, 80
+	}
+	return r, c
+}
+
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return string(out), err
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"find-large-dirs/scanner"
+)
+
+// scanTypeTotals sums the bytes and file counts per category over the
+// whole scan. It expects aggregated totals and only adds up the topmost
+// directories so that nothing is counted twice.
+func scanTypeTotals(m map[string]*scanner.FolderSize) (bytes, files map[string]int64) {
+	bytes, files = map[string]int64{}, map[string]int64{}
+	for p, fs := range m {
+		if par := filepath.Dir(p); par != p && m[par] != nil {
+			continue
+		}
+		for c, s := range fs.FileTypes {
+			bytes[c] += s
+		}
+		for c, n := range fs.TypeCounts {
+			files[c] += n
+		}
+	}
+	return bytes, files
+}
+
+// printTypeSummary prints the categories taking the most space across the
+// whole scan, at most top of them.
+func printTypeSummary(m map[string]*scanner.FolderSize, top int) {
+	bytes, files := scanTypeTotals(m)
+	var total int64
+	for _, s := range bytes {
+		total += s
+	}
+	if total == 0 {
+		return
+	}
+	fmt.Fprintln(stdout, "\nFile types across the scan:")
+	for i, p := range typeShares(bytes) {
+		if i >= top {
+			break
+		}
+		frac := float64(p.S) / float64(total)
+		fmt.Fprintf(stdout, "   %s%-12s%s %10s  %s%5.1f%%%s  %s(%s files)\n", color(getColorForCategory(p.C)), p.C, color(ColorReset),
+			formatSize(p.S), color(ColorGreen), frac*100, color(ColorReset), bar(frac), formatCount(files[p.C]))
+	}
+}
+
+// ownTypes returns, for every directory, the bytes per category of the
+// files directly inside it, undoing what AggregateTotals rolled up.
+func ownTypes(m map[string]*scanner.FolderSize) map[string]map[string]int64 {
+	own := make(map[string]map[string]int64, len(m))
+	for p, fs := range m {
+		t := make(map[string]int64, len(fs.FileTypes))
+		for c, s := range fs.FileTypes {
+			t[c] = s
+		}
+		own[p] = t
+	}
+	for p, fs := range m {
+		par := filepath.Dir(p)
+		if par == p || own[par] == nil {
+			continue
+		}
+		for c, s := range fs.FileTypes {
+			own[par][c] -= s
+		}
+	}
+	return own
+}
+
+// printByType prints the report grouped by category instead of directory:
+// each category with its share of the scan and the directories holding
+// most of it directly.
+func printByType(m map[string]*scanner.FolderSize, top int) {
+	bytes, files := scanTypeTotals(m)
+	var total int64
+	for _, s := range bytes {
+		total += s
+	}
+	if total == 0 {
+		fmt.Fprintln(stdout, "Nothing found.")
+		return
+	}
+	own := ownTypes(m)
+	for i, p := range typeShares(bytes) {
+		if i >= top {
+			break
+		}
+		fmt.Fprintf(stdout, "\n%s%s%s  %s  %s%.1f%%%s  (%s files)\n", color(getColorForCategory(p.C)), p.C, color(ColorReset),
+			formatSize(p.S), color(ColorGreen), float64(p.S)*100/float64(total), color(ColorReset), formatCount(files[p.C]))
+		var dirs []string
+		for d, t := range own {
+			if t[p.C] > 0 {
+				dirs = append(dirs, d)
+			}
+		}
+		sort.Slice(dirs, func(a, b int) bool {
+			if sa, sb := own[dirs[a]][p.C], own[dirs[b]][p.C]; sa != sb {
+				return sa > sb
+			}
+			return dirs[a] < dirs[b]
+		})
+		for j, d := range dirs {
+			if j >= 5 {
+				break
+			}
+			s := own[d][p.C]
+			fmt.Fprintf(stdout, "      • %s %6.1f%%  %s\n", padRight(shortenPath(d, 50), 50), float64(s)*100/float64(p.S), formatSize(s))
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"find-large-dirs/scanner"
+)
+
+// watch rescans root every interval until ctx is cancelled, printing the
+// top largest changes since the previous cycle and updating the db after
+// each complete cycle. Only the previous cycle's results are kept. When
+// reload is set it refreshes the exclude rules before every cycle; if it
+// fails the previous rules stay in force.
+func watch(ctx context.Context, root string, opts scanner.Options, interval time.Duration, top int, db string, reload func() (scanner.ExcludeRules, error)) {
+	prev, _ := loadPrev(db)
+	for {
+		if reload != nil {
+			if ex, err := reload(); err != nil {
+				fmt.Fprintln(os.Stderr, "--exclude-from:", err)
+			} else {
+				opts.Excludes = ex
+			}
+		}
+		start := time.Now()
+		m, err := scanner.Scan(ctx, root, opts)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return
+		}
+		scanner.AggregateTotals(m)
+		dropOutside(m, root)
+		total := int64(0)
+		if fs := m[root]; fs != nil {
+			total = fs.Total
+		}
+		delta := total
+		if fs := prev[root]; fs != nil {
+			delta -= fs.Total
+		}
+		fmt.Fprintf(stdout, "%s[%s]%s %s  %s  %s  (%s dirs, scanned in %s)\n", color(Bold), start.Format("15:04:05"), color(ColorReset),
+			root, formatSize(total), signedSize(delta), formatCount(int64(len(m))), time.Since(start).Round(time.Millisecond))
+		changes := diffSnapshots(prev, m)
+		if top > 0 && len(changes) > top {
+			changes = changes[:top]
+		}
+		for _, c := range changes {
+			fmt.Fprintf(stdout, "   %-8s %12s  %s\n", c.Status, signedSize(c.New-c.Old), c.Path)
+		}
+		saveHistory(db, m, time.Since(start), false)
+		prev = m
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
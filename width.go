@@ -0,0 +1,144 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// wideRanges lists the code points a terminal draws two cells wide: the
+// East Asian Wide and Fullwidth blocks and the emoji pictographs.
+var wideRanges = []struct{ lo, hi rune }{
+	{0x1100, 0x115F},   // Hangul Jamo
+	{0x231A, 0x231B},   // watch, hourglass
+	{0x2329, 0x232A},   // angle brackets
+	{0x23E9, 0x23EC},   // media controls
+	{0x23F0, 0x23F0},   // alarm clock
+	{0x23F3, 0x23F3},   // hourglass
+	{0x25FD, 0x25FE},   // small squares
+	{0x2614, 0x2615},   // umbrella, hot beverage
+	{0x2648, 0x2653},   // zodiac
+	{0x267F, 0x267F},   // wheelchair
+	{0x2693, 0x2693},   // anchor
+	{0x26A1, 0x26A1},   // high voltage
+	{0x26AA, 0x26AB},   // circles
+	{0x26BD, 0x26BE},   // balls
+	{0x26C4, 0x26C5},   // snowman, sun
+	{0x26CE, 0x26CE},   // ophiuchus
+	{0x26D4, 0x26D4},   // no entry
+	{0x26EA, 0x26EA},   // church
+	{0x26F2, 0x26F5},   // fountain … sailboat
+	{0x26FA, 0x26FD},   // tent … fuel pump
+	{0x2705, 0x2705},   // check mark
+	{0x270A, 0x270B},   // fists
+	{0x2728, 0x2728},   // sparkles
+	{0x274C, 0x274C},   // cross mark
+	{0x274E, 0x274E},   // cross mark
+	{0x2753, 0x2755},   // question marks
+	{0x2757, 0x2757},   // exclamation mark
+	{0x2795, 0x2797},   // heavy plus … division
+	{0x27B0, 0x27B0},   // curly loop
+	{0x27BF, 0x27BF},   // double curly loop
+	{0x2B1B, 0x2B1C},   // large squares
+	{0x2B50, 0x2B50},   // star
+	{0x2B55, 0x2B55},   // circle
+	{0x2E80, 0x303E},   // CJK radicals … CJK symbols
+	{0x3041, 0x33FF},   // Hiragana … CJK compatibility
+	{0x3400, 0x4DBF},   // CJK extension A
+	{0x4E00, 0x9FFF},   // CJK unified ideographs
+	{0xA000, 0xA4CF},   // Yi
+	{0xA960, 0xA97F},   // Hangul Jamo extended A
+	{0xAC00, 0xD7A3},   // Hangul syllables
+	{0xF900, 0xFAFF},   // CJK compatibility ideographs
+	{0xFE10, 0xFE19},   // vertical forms
+	{0xFE30, 0xFE6F},   // CJK compatibility forms, small forms
+	{0xFF00, 0xFF60},   // fullwidth forms
+	{0xFFE0, 0xFFE6},   // fullwidth signs
+	{0x16FE0, 0x18AFF}, // Tangut
+	{0x1B000, 0x1B2FF}, // Kana supplement
+	{0x1F004, 0x1F004}, // mahjong tile
+	{0x1F0CF, 0x1F0CF}, // joker
+	{0x1F18E, 0x1F18E}, // AB button
+	{0x1F191, 0x1F19A}, // squared words
+	{0x1F200, 0x1F2FF}, // enclosed ideographs
+	{0x1F300, 0x1F64F}, // pictographs, emoticons
+	{0x1F680, 0x1F6FF}, // transport and map symbols
+	{0x1F7E0, 0x1F7EB}, // coloured circles and squares
+	{0x1F90C, 0x1F9FF}, // supplemental pictographs
+	{0x1FA70, 0x1FAFF}, // pictographs extended A
+	{0x20000, 0x3FFFD}, // CJK extensions B and later
+}
+
+// runeWidth returns the number of terminal cells r takes: 0 for combining
+// marks and format characters, 2 for wide characters, 1 otherwise.
+func runeWidth(r rune) int {
+	if r == 0 || unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf) {
+		return 0
+	}
+	if r < 0x1100 {
+		return 1
+	}
+	for _, w := range wideRanges {
+		if r < w.lo {
+			break
+		}
+		if r <= w.hi {
+			return 2
+		}
+	}
+	return 1
+}
+
+// displayWidth returns the number of terminal cells s takes.
+func displayWidth(s string) int {
+	n := 0
+	for _, r := range s {
+		n += runeWidth(r)
+	}
+	return n
+}
+
+// padRight pads s with spaces to n cells; %-Ns counts bytes instead and
+// misaligns anything outside ASCII.
+func padRight(s string, n int) string {
+	if w := displayWidth(s); w < n {
+		return s + strings.Repeat(" ", n-w)
+	}
+	return s
+}
+
+// shortenPath fits p into n cells. It keeps the end of the path, where the
+// directory names that tell folders apart are, and marks the cut with "…".
+func shortenPath(p string, n int) string {
+	if displayWidth(p) <= n {
+		return p
+	}
+	rs := []rune(p)
+	w, i := 1, len(rs)
+	for i > 0 && w+runeWidth(rs[i-1]) <= n {
+		i--
+		w += runeWidth(rs[i])
+	}
+	// combining marks whose base character was cut go with it
+	for i < len(rs) && runeWidth(rs[i]) == 0 {
+		i++
+	}
+	return "…" + string(rs[i:])
+}
+
+// truncateRight fits s into n cells, keeping its beginning.
+func truncateRight(s string, n int) string {
+	if displayWidth(s) <= n {
+		return s
+	}
+	var sb strings.Builder
+	w := 1
+	for _, r := range s {
+		if w+runeWidth(r) > n {
+			break
+		}
+		w += runeWidth(r)
+		sb.WriteRune(r)
+	}
+	sb.WriteString("…")
+	return sb.String()
+}
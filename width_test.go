@@ -0,0 +1,66 @@
+package main
+
+import "testing"
+
+func TestDisplayWidth(t *testing.T) {
+	for _, c := range []struct {
+		s    string
+		want int
+	}{
+		{"abc", 3},
+		{"日本語", 6},
+		{"한국어", 6},
+		{"😀", 2},
+		{"a😀b", 4},
+		{"e\u0301", 1},     // e and a combining acute accent
+		{"cafe\u0301s", 5}, // cafés
+		{"a\u200db", 2},    // zero width joiner
+		{"Ｆｕｌｌ", 8},
+	} {
+		if got := displayWidth(c.s); got != c.want {
+			t.Errorf("displayWidth(%q) = %d, want %d", c.s, got, c.want)
+		}
+	}
+}
+
+func TestPadRight(t *testing.T) {
+	for _, c := range []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{"ab", 4, "ab  "},
+		{"日本", 6, "日本  "},
+		{"😀", 3, "😀 "},
+		{"e\u0301", 3, "e\u0301  "},
+		{"日本語", 4, "日本語"},
+	} {
+		if got := padRight(c.s, c.n); got != c.want {
+			t.Errorf("padRight(%q, %d) = %q, want %q", c.s, c.n, got, c.want)
+		}
+	}
+}
+
+func TestShortenPath(t *testing.T) {
+	for _, c := range []struct {
+		p    string
+		n    int
+		want string
+	}{
+		{"/data/logs", 20, "/data/logs"},
+		{"/data/logs", 6, "…/logs"},
+		{"/データ/写真", 6, "…/写真"},
+		{"/データ/写真", 5, "…写真"},
+		{"/a/😀😀", 4, "…😀"},
+		{"/x/cafe\u0301s", 3, "…e\u0301s"},
+		{"/x/e\u0301e", 2, "…e"}, // the accent goes with its e
+	} {
+		got := shortenPath(c.p, c.n)
+		if got != c.want {
+			t.Errorf("shortenPath(%q, %d) = %q, want %q", c.p, c.n, got, c.want)
+		}
+		if w := displayWidth(got); w > c.n {
+			t.Errorf("shortenPath(%q, %d) is %d cells wide", c.p, c.n, w)
+		}
+	}
+}